@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const agentSocketFile = "agent.sock"
+
+// agentRequest is sent over the agent socket, one request per connection
+type agentRequest struct {
+	Op  string        `json:"op"`
+	ID  string        `json:"id,omitempty"`
+	Key []byte        `json:"key,omitempty"`
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+type agentResponse struct {
+	OK    bool   `json:"ok"`
+	Key   []byte `json:"key,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+func agentSocketPath() (string, error) {
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hpcgameDir, agentSocketFile), nil
+}
+
+// agentTTL returns how long unlocked keys are cached, 0 disables the agent
+func agentTTL() time.Duration {
+	value := loadSettings().String("agent_ttl")
+	if value == "0" {
+		return 0
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
+
+func agentCall(req agentRequest) (*agentResponse, error) {
+	path, err := agentSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	resp := &agentResponse{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
+
+// agentGetKey returns a cached key, or nil if the agent does not have it
+func agentGetKey(id string) []byte {
+	resp, err := agentCall(agentRequest{Op: "get", ID: id})
+	if err != nil {
+		return nil
+	}
+	return resp.Key
+}
+
+// agentAddKey caches a key in the agent, starting the agent if needed.
+// Failures only mean the passphrase is asked again next time.
+func agentAddKey(id string, key []byte) {
+	ttl := agentTTL()
+	if ttl == 0 {
+		return
+	}
+	if _, err := agentCall(agentRequest{Op: "ping"}); err != nil {
+		if err := startAgent(); err != nil {
+			debugf("Failed to start agent: %s", err)
+			return
+		}
+	}
+	if _, err := agentCall(agentRequest{Op: "add", ID: id, Key: key, TTL: ttl}); err != nil {
+		debugf("Failed to cache key in agent: %s", err)
+	}
+}
+
+// startAgent runs 'hpcgame agent serve' in the background and waits until
+// it accepts connections
+func startAgent() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, "agent", "serve")
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	cmd.Process.Release()
+
+	for i := 0; i < 20; i++ {
+		if _, err := agentCall(agentRequest{Op: "ping"}); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("agent did not start")
+}
+
+// serveAgent caches unlocked kubeconfig keys in memory until they expire.
+// It exits once the cache is empty, or when asked to stop.
+func serveAgent() error {
+	path, err := agentSocketPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if _, err := agentCall(agentRequest{Op: "ping"}); err == nil {
+		return fmt.Errorf("agent is already running")
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	// The agent outlives the terminal that started it
+	signal.Ignore(os.Interrupt, syscall.SIGHUP)
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+
+	var mu sync.Mutex
+	keys := map[string]cachedKey{}
+	started := time.Now()
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	shutdown := func() { stopOnce.Do(func() { close(stop) }) }
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				for id, cached := range keys {
+					if time.Now().After(cached.expires) {
+						delete(keys, id)
+					}
+				}
+				empty := len(keys) == 0
+				mu.Unlock()
+				if empty && time.Since(started) > time.Minute {
+					shutdown()
+				}
+			case <-terminate:
+				shutdown()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-stop
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			var req agentRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				return
+			}
+			resp := agentResponse{OK: true}
+
+			mu.Lock()
+			switch req.Op {
+			case "ping":
+			case "get":
+				if cached, ok := keys[req.ID]; ok && time.Now().Before(cached.expires) {
+					resp.Key = cached.key
+				} else {
+					resp.OK, resp.Error = false, "not found"
+				}
+			case "add":
+				keys[req.ID] = cachedKey{key: req.Key, expires: time.Now().Add(req.TTL)}
+			case "status":
+				resp.Count = len(keys)
+			case "stop":
+				keys = map[string]cachedKey{}
+				shutdown()
+			default:
+				resp.OK, resp.Error = false, "unknown operation "+req.Op
+			}
+			mu.Unlock()
+
+			json.NewEncoder(conn).Encode(resp)
+		}(conn)
+	}
+}
+
+func handleAgentCommands() {
+	subCommand := "status"
+	if len(os.Args) > 2 {
+		subCommand = os.Args[2]
+	}
+
+	switch subCommand {
+	case "status":
+		resp, err := agentCall(agentRequest{Op: "status"})
+		if err != nil {
+			fmt.Println("Agent is not running")
+			return
+		}
+		fmt.Printf("Agent is running with %d unlocked kubeconfig(s), keys are kept for %s\n", resp.Count, agentTTL())
+	case "start":
+		if _, err := agentCall(agentRequest{Op: "ping"}); err == nil {
+			fmt.Println("Agent is already running")
+			return
+		}
+		if err := startAgent(); err != nil {
+			fmt.Printf("Failed to start agent: %s\n", err)
+			return
+		}
+		fmt.Println("✅ Agent started")
+	case "stop", "lock":
+		if _, err := agentCall(agentRequest{Op: "stop"}); err != nil {
+			fmt.Println("Agent is not running")
+			return
+		}
+		fmt.Println("✅ Agent stopped, cached passphrases were forgotten")
+	case "serve":
+		if err := serveAgent(); err != nil {
+			fmt.Fprintf(os.Stderr, "Agent failed: %s\n", err)
+			exit(exitFailure)
+		}
+	default:
+		fmt.Printf("Unknown agent subcommand: %s\n", subCommand)
+		printAgentHelp()
+	}
+}
+
+func printAgentHelp() {
+	helpText := `Agent command usage:
+  hpcgame agent status   Show whether the agent is running
+  hpcgame agent start    Start the agent in the background
+  hpcgame agent stop     Stop the agent and forget cached passphrases (alias: lock)
+  hpcgame agent serve    Run the agent in the foreground
+
+Note:
+  - The agent starts automatically when an encrypted kubeconfig is unlocked
+  - Keys are cached in memory for agent_ttl (default 30m) and the agent exits
+    when none are left; set agent_ttl to 0 to disable caching
+`
+	fmt.Println(helpText)
+}
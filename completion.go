@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completeCommand is the hidden command the completion scripts call with the
+// words typed so far; it prints one candidate per line
+const completeCommand = "__complete"
+
+// completionCacheTTL is how long container and volume names are reused, so
+// that pressing tab does not query the cluster every time
+const completionCacheTTL = 30 * time.Second
+
+// completing is set while answering __complete, which must never prompt
+var completing bool
+
+var completionCommands = []string{
+	"install", "uninstall", "shell-init", "login", "help", "version",
+	"create", "ls", "lspart", "shell", "delete", "portforward", "volume",
+	"run", "ps", "images", "exec", "cp", "sync", "port", "proxy", "ssh-config", "rm",
+	"config", "task", "profile", "kubectl", "kubeconfig", "agent", "doctor", "completion", "update",
+}
+
+var completionFlags = map[string][]string{
+	"install":    {"--kubeconfig-file", "--kubeconfig-env", "--from", "--context", "--kubectl-dir", "--kubectl-file", "--kubectl-sha256", "--insecure-skip-verify", "--no-vscode", "--no-modify-rc", "--force", "--yes"},
+	"uninstall":  {"--dry-run", "--remote", "--yes"},
+	"login":      {"--kubeconfig-file", "--kubeconfig-env", "--token"},
+	"doctor":     {"--json"},
+	"create":     {"--partition", "--cpu", "--memory", "--gpu", "--image", "--name", "--volumes", "--help"},
+	"run":        {"--partition", "--cpu", "--memory", "--gpu", "--image", "--name", "--volume", "--help"},
+	"exec":       {"-it"},
+	"kubeconfig": {"--kubeconfig", "--name", "--use"},
+	"update":     {"--check", "--force", "--yes"},
+	"port":       {"--publish", "--address", "--detach"},
+	"proxy":      {"--socks", "--http"},
+	"ssh-config": {"--write", "--user"},
+	"cp":         {"--quiet", "--archive", "--chown", "--compress", "--chunk-size", "--no-resume", "--no-verify"},
+	"sync":       {"--exclude", "--delete", "--dry-run", "--verbose", "--watch", "--run", "--debounce"},
+}
+
+var completionSubcommands = map[string][]string{
+	"volume":     {"ls", "create", "delete", "rm"},
+	"volumes":    {"ls", "create", "delete", "rm"},
+	"config":     {"list", "get", "set", "unset", "explain"},
+	"task":       {"ls", "run"},
+	"tasks":      {"ls", "run"},
+	"profile":    {"ls", "add", "use", "rm", "set", "unset", "current"},
+	"profiles":   {"ls", "add", "use", "rm", "set", "unset", "current"},
+	"kubectl":    {"ls", "install", "use", "rm", "check"},
+	"kubeconfig": {"status", "encrypt", "decrypt", "export"},
+	"agent":      {"status", "start", "stop"},
+	"completion": supportedShells,
+	"shell-init": supportedShells,
+}
+
+// completeWords prints the candidates for the last word of args
+func completeWords(args []string) {
+	// Anything printed while looking up names must not end up as a candidate
+	stdout := os.Stdout
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdout = devNull
+		defer devNull.Close()
+	}
+	completing = true
+
+	candidates := completionCandidates(args)
+
+	os.Stdout = stdout
+	current := ""
+	if len(args) > 0 {
+		current = args[len(args)-1]
+	}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Println(candidate)
+		}
+	}
+}
+
+func completionCandidates(args []string) []string {
+	if len(args) == 0 {
+		return completionCommands
+	}
+	current := args[len(args)-1]
+
+	// Apply global options typed before the current word
+	var words []string
+	for i := 0; i < len(args)-1; i++ {
+		arg := args[i]
+		switch {
+		case (arg == "--profile" || arg == "--namespace" || (arg == "-n" && len(words) == 0)) && i == len(args)-2:
+			if arg == "--profile" {
+				return listProfileNames()
+			}
+			return nil
+		case arg == "--profile" && i+1 < len(args)-1:
+			profileFlag = args[i+1]
+			i++
+		case (arg == "--namespace" || (arg == "-n" && len(words) == 0)) && i+1 < len(args)-1:
+			namespaceFlag = args[i+1]
+			i++
+		case arg == "--verbose" || strings.HasPrefix(arg, "--profile=") || strings.HasPrefix(arg, "--namespace="):
+		default:
+			words = append(words, arg)
+		}
+	}
+
+	if len(words) == 0 {
+		if strings.HasPrefix(current, "-") {
+			return []string{"--profile", "--namespace", "--verbose"}
+		}
+		return completionCommands
+	}
+	command := words[0]
+	words = words[1:]
+
+	previous := ""
+	if len(words) > 0 {
+		previous = words[len(words)-1]
+	}
+
+	// Flag values
+	switch command {
+	case "create", "run":
+		switch previous {
+		case "-p", "--partition":
+			return partitionNames()
+		case "-i", "--image":
+			return imageNames(flagValue(words, "-p", "--partition"))
+		case "-v", "--volume", "--volumes":
+			return volumeListCandidates(current)
+		case "-n", "--name", "-c", "--cpu", "-m", "--memory", "-g", "--gpu":
+			return nil
+		}
+	case "install":
+		if previous == "--context" {
+			return kubeconfigContexts(flagValue(words, "--from", "--kubeconfig-file"))
+		}
+	}
+	if strings.HasPrefix(current, "-") {
+		return completionFlags[command]
+	}
+
+	positional := positionalArgs(command, words)
+	switch command {
+	case "shell", "delete", "rm", "kill", "stop":
+		if len(positional) == 0 {
+			return containerNames()
+		}
+	case "ssh-config":
+		return containerNames()
+	case "port", "ports", "portforward":
+		if len(positional) == 0 {
+			return append([]string{"ls", "stop"}, containerNames()...)
+		}
+		if len(positional) == 1 && positional[0] == "stop" {
+			candidates := []string{"--all"}
+			for _, state := range loadForwards() {
+				candidates = append(candidates, state.ID)
+			}
+			return candidates
+		}
+	case "exec":
+		if len(positional) == 0 {
+			return containerNames()
+		}
+	case "run":
+		if len(positional) == 0 {
+			return imageNames(flagValue(words, "-p", "--partition"))
+		}
+	case "cp", "sync":
+		// Remote paths are written as container:path or volume:name:path
+		var candidates []string
+		for _, name := range containerNames() {
+			candidates = append(candidates, name+":")
+		}
+		if command == "cp" {
+			for _, name := range volumeNames(true) {
+				candidates = append(candidates, volumePrefix+name+":")
+			}
+		}
+		return candidates
+	case "volume", "volumes":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+		if len(positional) == 1 && (positional[0] == "delete" || positional[0] == "rm") {
+			return volumeNames(false)
+		}
+		if len(positional) == 4 && positional[0] == "create" {
+			return []string{"ReadWriteOnce", "ReadWriteMany", "ReadOnlyMany"}
+		}
+	case "config":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+		if len(positional) == 1 && (positional[0] == "get" || positional[0] == "set" || positional[0] == "unset") {
+			return configKeyNames()
+		}
+	case "profile", "profiles":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+		switch positional[0] {
+		case "use", "switch", "rm", "remove", "delete", "set", "unset":
+			if len(positional) == 1 {
+				return listProfileNames()
+			}
+			if len(positional) == 2 && (positional[0] == "set" || positional[0] == "unset") {
+				return configKeyNames()
+			}
+		}
+	case "task", "tasks":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+		if positional[0] == "run" {
+			if len(positional) == 1 {
+				if project := loadProject(); project != nil {
+					return project.taskNames()
+				}
+			}
+			if len(positional) == 2 {
+				return containerNames()
+			}
+		}
+	case "kubectl":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+		if len(positional) == 1 && positional[0] == "use" {
+			return append(listManagedKubectl(), "system")
+		}
+		if len(positional) == 1 && positional[0] == "rm" {
+			return listManagedKubectl()
+		}
+	case "kubeconfig", "agent", "completion", "shell-init":
+		if len(positional) == 0 {
+			return completionSubcommands[command]
+		}
+	case "help":
+		if len(positional) == 0 {
+			return completionCommands
+		}
+	}
+	return nil
+}
+
+// completionValueFlags are the flags that take a value as the next word
+var completionValueFlags = map[string]bool{
+	"-p": true, "--partition": true, "-c": true, "--cpu": true, "-m": true, "--memory": true,
+	"-g": true, "--gpu": true, "-i": true, "--image": true, "-n": true, "--name": true,
+	"-v": true, "--volume": true, "--volumes": true,
+	"--kubeconfig-file": true, "--kubeconfig-env": true, "--from": true, "--context": true,
+	"--kubectl-dir": true, "--kubectl-file": true, "--kubectl-sha256": true,
+	"--token": true, "--kubeconfig": true, "--exclude": true, "--run": true, "--debounce": true, "--compress": true, "--chunk-size": true,
+	"--chown": true, "--publish": true, "--address": true, "--socks": true, "--http": true, "--user": true,
+}
+
+// positionalArgs drops flags and their values from the words of a command
+func positionalArgs(command string, words []string) []string {
+	var positional []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if strings.HasPrefix(word, "-") {
+			// exec only takes boolean flags such as -it
+			if command != "exec" && completionValueFlags[word] {
+				i++
+			}
+			continue
+		}
+		positional = append(positional, word)
+	}
+	return positional
+}
+
+// flagValue returns the value given for a flag among words, if any
+func flagValue(words []string, names ...string) string {
+	for i, word := range words {
+		for _, name := range names {
+			if word == name && i+1 < len(words) {
+				return words[i+1]
+			}
+			if strings.HasPrefix(word, name+"=") {
+				return strings.TrimPrefix(word, name+"=")
+			}
+		}
+	}
+	return ""
+}
+
+// cachedPartitions reads the partition list cached by lspart, without
+// fetching it from the network
+func cachedPartitions() []Partition {
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "partitions.json"))
+	if err != nil {
+		return nil
+	}
+	var partitions []Partition
+	if err := json.Unmarshal(data, &partitions); err != nil {
+		return nil
+	}
+	return partitions
+}
+
+func partitionNames() []string {
+	var names []string
+	for _, partition := range cachedPartitions() {
+		names = append(names, partition.Name)
+	}
+	return names
+}
+
+// imageNames lists the verified images of a partition, or of all partitions
+func imageNames(partition string) []string {
+	seen := map[string]bool{}
+	var images []string
+	for _, p := range cachedPartitions() {
+		if partition != "" && p.Name != partition {
+			continue
+		}
+		for _, image := range p.Images {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+	return images
+}
+
+func configKeyNames() []string {
+	var names []string
+	for _, key := range configKeys {
+		if key.Name == "image.<partition>" {
+			for _, partition := range partitionNames() {
+				names = append(names, "image."+partition)
+			}
+			continue
+		}
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+// kubeconfigContexts lists the contexts of a kubeconfig file for --context
+func kubeconfigContexts(path string) []string {
+	if path == "" {
+		var err error
+		if path, err = defaultKubectlConfig(); err != nil {
+			return nil
+		}
+	}
+	config, err := readKubeconfig(expandHome(path))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, ctx := range config.Contexts {
+		names = append(names, ctx.Name)
+	}
+	return names
+}
+
+// cachedNames returns names listed by a kubectl query, reusing the result for
+// completionCacheTTL
+func cachedNames(cacheName string, kubectlArgs ...string) []string {
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		return nil
+	}
+	cacheDir := filepath.Join(dir, "completion-cache")
+	cacheFile := filepath.Join(cacheDir, cacheName)
+
+	if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < completionCacheTTL {
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			return strings.Fields(string(data))
+		}
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return nil
+	}
+	output, err := kubectlCommand(kubeconfigPath, append(kubectlArgs, "--request-timeout=5s")...).Output()
+	if err != nil {
+		return nil
+	}
+	names := strings.Fields(string(output))
+	sort.Strings(names)
+
+	if err := os.MkdirAll(cacheDir, 0700); err == nil {
+		os.WriteFile(cacheFile, []byte(strings.Join(names, "\n")+"\n"), 0600)
+	}
+	return names
+}
+
+// invalidateCompletionCache drops cached names after containers or volumes changed
+func invalidateCompletionCache() {
+	if dir, err := profileDir(currentProfile()); err == nil {
+		os.RemoveAll(filepath.Join(dir, "completion-cache"))
+	}
+}
+
+func containerNames() []string {
+	return cachedNames("containers", "get", "pods", "-o", "jsonpath={.items[*].metadata.name}")
+}
+
+// volumeNames lists persistent volume claims, optionally with the default ones
+func volumeNames(includeDefault bool) []string {
+	var names []string
+	for _, name := range cachedNames("volumes", "get", "pvc", "-o", "jsonpath={.items[*].metadata.name}") {
+		if includeDefault || !strings.Contains(name, "-default-pvc") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// volumeListCandidates completes the last entry of a comma-separated list
+func volumeListCandidates(current string) []string {
+	prefix := ""
+	if i := strings.LastIndex(current, ","); i >= 0 {
+		prefix = current[:i+1]
+	}
+	chosen := map[string]bool{}
+	for _, name := range splitList(prefix) {
+		chosen[name] = true
+	}
+	var candidates []string
+	for _, name := range volumeNames(false) {
+		if !chosen[name] {
+			candidates = append(candidates, prefix+name)
+		}
+	}
+	return candidates
+}
+
+func completion() {
+	shell := detectShell()
+	if len(os.Args) > 2 {
+		shell = os.Args[2]
+	}
+
+	script := completionScript(shell)
+	if script == "" {
+		fmt.Fprintln(os.Stderr, "Usage: hpcgame completion bash|zsh|fish")
+		fmt.Fprintln(os.Stderr, "Load it in your shell startup file, e.g.:")
+		fmt.Fprintln(os.Stderr, "  bash: source <(hpcgame completion bash)")
+		fmt.Fprintln(os.Stderr, "  zsh:  source <(hpcgame completion zsh)")
+		fmt.Fprintln(os.Stderr, "  fish: hpcgame completion fish | source")
+		fmt.Fprintln(os.Stderr, "'hpcgame shell-init' already includes it.")
+		exit(exitUsage)
+	}
+	fmt.Print(script)
+}
+
+func completionScript(shell string) string {
+	switch shell {
+	case "bash":
+		return `# bash completion for hpcgame
+_hpcgame() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null 2>&1; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($(hpcgame __complete "${words[@]:1:cword}" 2>/dev/null))
+    if declare -F __ltrim_colon_completions >/dev/null 2>&1; then
+        __ltrim_colon_completions "$cur"
+    fi
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *[:,] ]]; then
+        compopt -o nospace 2>/dev/null
+    fi
+}
+complete -o default -F _hpcgame hpcgame
+`
+	case "zsh":
+		return `#compdef hpcgame
+# zsh completion for hpcgame
+_hpcgame() {
+    local -a candidates nospace
+    candidates=("${(@f)$(hpcgame __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    if (( ${#candidates} == 0 )); then
+        _files
+        return
+    fi
+    nospace=(${(M)candidates:#*[:,]})
+    candidates=(${candidates:#*[:,]})
+    (( ${#candidates} )) && compadd -- $candidates
+    (( ${#nospace} )) && compadd -S '' -- $nospace
+}
+(( $+functions[compdef] )) && compdef _hpcgame hpcgame
+`
+	case "fish":
+		return `# fish completion for hpcgame
+function __hpcgame_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    hpcgame __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c hpcgame -f -a '(__hpcgame_complete)'
+complete -c hpcgame -n '__fish_seen_subcommand_from cp install login' -F
+`
+	}
+	return ""
+}
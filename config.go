@@ -0,0 +1,654 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const configFile = "config.yaml"
+
+// Config holds the user defaults stored in ~/.hpcgame/config.yaml
+type Config struct {
+	Name      string            `yaml:"name,omitempty"`
+	Partition string            `yaml:"partition,omitempty"`
+	Image     string            `yaml:"image,omitempty"`
+	Images    map[string]string `yaml:"images,omitempty"`
+	CPU       int               `yaml:"cpu,omitempty"`
+	Memory    int               `yaml:"memory,omitempty"`
+	GPU       int               `yaml:"gpu,omitempty"`
+	Volumes   []string          `yaml:"volumes,omitempty"`
+	Output    string            `yaml:"output,omitempty"`
+	Confirm   *bool             `yaml:"confirm,omitempty"`
+
+	Namespace       string `yaml:"namespace,omitempty"`
+	PartitionSource string `yaml:"partition_source,omitempty"`
+	KubectlVersion  string `yaml:"kubectl_version,omitempty"`
+	KubectlMirror   string `yaml:"kubectl_mirror,omitempty"`
+	AgentTTL        string `yaml:"agent_ttl,omitempty"`
+	UpdateURL       string `yaml:"update_url,omitempty"`
+	UpdateCheck     *bool  `yaml:"update_check,omitempty"`
+}
+
+type configKey struct {
+	Name        string
+	Description string
+	Validate    func(value string) error
+}
+
+var configKeys = []configKey{
+	{"name", "Default container name for create/run, tasks and sync", nil},
+	{"partition", "Default partition for create/run", nil},
+	{"image", "Default image for any partition", nil},
+	{"image.<partition>", "Default image for the given partition", nil},
+	{"cpu", "Default number of CPUs", validateNonNegativeInt},
+	{"memory", "Default memory in GiB", validateNonNegativeInt},
+	{"gpu", "Default number of GPUs", validateNonNegativeInt},
+	{"volumes", "Extra volumes to mount (comma-separated)", nil},
+	{"output", "Output format for ls/lspart/images/volume ls (table or json)", validateOneOf("table", "json")},
+	{"confirm", "Ask for confirmation before uncertain operations; overwrites and deletions always ask (true or false)", validateBool},
+	{"namespace", "Kubernetes namespace (defaults to the kubeconfig context)", nil},
+	{"partition_source", "URL of the partition list", nil},
+	{"kubectl_version", "kubectl version installed by 'hpcgame install'", nil},
+	{"kubectl_mirror", "Base URL kubectl is downloaded from", nil},
+	{"agent_ttl", "How long the agent caches the kubeconfig passphrase (e.g. 30m, 0 to disable)", validateDuration},
+	{"update_url", "Release feed checked by 'hpcgame update' (GitHub releases API format)", nil},
+	{"update_check", "Check for new releases once a day and print a notice (true or false)", validateBool},
+}
+
+// builtinDefaults are the values used when nothing else is configured
+var builtinDefaults = map[string]string{
+	"output":           "table",
+	"confirm":          "true",
+	"partition_source": "https://hpcgame.pku.edu.cn/oss/images/public/partitions.json",
+	"kubectl_version":  "v1.32.3",
+	"kubectl_mirror":   "https://dl.k8s.io/release",
+	"agent_ttl":        "30m",
+	"update_url":       "https://api.github.com/repos/lcpu-club/hpcgame-kube-cli/releases/latest",
+	"update_check":     "true",
+}
+
+func validateNonNegativeInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("expected a non-negative integer, got %q", value)
+	}
+	return nil
+}
+
+func validateBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("expected true or false, got %q", value)
+	}
+	return nil
+}
+
+func validateDuration(value string) error {
+	if value == "0" {
+		return nil
+	}
+	if d, err := time.ParseDuration(value); err != nil || d < 0 {
+		return fmt.Errorf("expected a duration such as 30m or 2h, got %q", value)
+	}
+	return nil
+}
+
+func validateOneOf(choices ...string) func(string) error {
+	return func(value string) error {
+		for _, c := range choices {
+			if value == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(choices, ", "), value)
+	}
+}
+
+func lookupConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	if strings.HasPrefix(name, "image.") && len(name) > len("image.") {
+		return lookupConfigKey("image.<partition>")
+	}
+	return configKey{}, false
+}
+
+// hpcgameHome returns the directory holding the kubeconfig, partition cache
+// and config file. It defaults to ~/.hpcgame and can be moved with HPCGAME_HOME.
+func hpcgameHome() (string, error) {
+	if dir := os.Getenv("HPCGAME_HOME"); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, kubeconfigDir), nil
+}
+
+func userConfigPath() (string, error) {
+	dir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFile), nil
+}
+
+// readConfigFile loads a config file, returning an empty config if it does not exist
+func readConfigFile(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+func writeConfigFile(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// values flattens the config into dotted keys, omitting unset fields
+func (c *Config) values() map[string]string {
+	values := map[string]string{}
+	if c.Name != "" {
+		values["name"] = c.Name
+	}
+	if c.Partition != "" {
+		values["partition"] = c.Partition
+	}
+	if c.Image != "" {
+		values["image"] = c.Image
+	}
+	for partition, image := range c.Images {
+		values["image."+partition] = image
+	}
+	if c.CPU > 0 {
+		values["cpu"] = strconv.Itoa(c.CPU)
+	}
+	if c.Memory > 0 {
+		values["memory"] = strconv.Itoa(c.Memory)
+	}
+	if c.GPU > 0 {
+		values["gpu"] = strconv.Itoa(c.GPU)
+	}
+	if len(c.Volumes) > 0 {
+		values["volumes"] = strings.Join(c.Volumes, ",")
+	}
+	if c.Output != "" {
+		values["output"] = c.Output
+	}
+	if c.Confirm != nil {
+		values["confirm"] = strconv.FormatBool(*c.Confirm)
+	}
+	if c.Namespace != "" {
+		values["namespace"] = c.Namespace
+	}
+	if c.PartitionSource != "" {
+		values["partition_source"] = c.PartitionSource
+	}
+	if c.KubectlVersion != "" {
+		values["kubectl_version"] = c.KubectlVersion
+	}
+	if c.KubectlMirror != "" {
+		values["kubectl_mirror"] = c.KubectlMirror
+	}
+	if c.AgentTTL != "" {
+		values["agent_ttl"] = c.AgentTTL
+	}
+	if c.UpdateURL != "" {
+		values["update_url"] = c.UpdateURL
+	}
+	if c.UpdateCheck != nil {
+		values["update_check"] = strconv.FormatBool(*c.UpdateCheck)
+	}
+	return values
+}
+
+func (c *Config) set(key string, value string) error {
+	spec, ok := lookupConfigKey(key)
+	if !ok {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	if spec.Validate != nil {
+		if err := spec.Validate(value); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case key == "name":
+		c.Name = value
+	case key == "partition":
+		c.Partition = value
+	case key == "image":
+		c.Image = value
+	case strings.HasPrefix(key, "image."):
+		if c.Images == nil {
+			c.Images = map[string]string{}
+		}
+		c.Images[strings.TrimPrefix(key, "image.")] = value
+	case key == "cpu":
+		c.CPU, _ = strconv.Atoi(value)
+	case key == "memory":
+		c.Memory, _ = strconv.Atoi(value)
+	case key == "gpu":
+		c.GPU, _ = strconv.Atoi(value)
+	case key == "volumes":
+		c.Volumes = splitList(value)
+	case key == "output":
+		c.Output = value
+	case key == "confirm":
+		confirm, _ := strconv.ParseBool(value)
+		c.Confirm = &confirm
+	case key == "namespace":
+		c.Namespace = value
+	case key == "partition_source":
+		c.PartitionSource = value
+	case key == "kubectl_version":
+		c.KubectlVersion = value
+	case key == "kubectl_mirror":
+		c.KubectlMirror = value
+	case key == "agent_ttl":
+		c.AgentTTL = value
+	case key == "update_url":
+		c.UpdateURL = value
+	case key == "update_check":
+		check, _ := strconv.ParseBool(value)
+		c.UpdateCheck = &check
+	}
+	return nil
+}
+
+func (c *Config) unset(key string) error {
+	if _, ok := lookupConfigKey(key); !ok {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+
+	switch {
+	case key == "name":
+		c.Name = ""
+	case key == "partition":
+		c.Partition = ""
+	case key == "image":
+		c.Image = ""
+	case strings.HasPrefix(key, "image."):
+		delete(c.Images, strings.TrimPrefix(key, "image."))
+	case key == "cpu":
+		c.CPU = 0
+	case key == "memory":
+		c.Memory = 0
+	case key == "gpu":
+		c.GPU = 0
+	case key == "volumes":
+		c.Volumes = nil
+	case key == "output":
+		c.Output = ""
+	case key == "confirm":
+		c.Confirm = nil
+	case key == "namespace":
+		c.Namespace = ""
+	case key == "partition_source":
+		c.PartitionSource = ""
+	case key == "kubectl_version":
+		c.KubectlVersion = ""
+	case key == "kubectl_mirror":
+		c.KubectlMirror = ""
+	case key == "agent_ttl":
+		c.AgentTTL = ""
+	case key == "update_url":
+		c.UpdateURL = ""
+	case key == "update_check":
+		c.UpdateCheck = nil
+	}
+	return nil
+}
+
+// envConfigValues returns the overrides given by HPCGAME_* environment variables
+func envConfigValues() map[string]string {
+	values := map[string]string{}
+	for _, key := range configKeys {
+		if strings.Contains(key.Name, "<") {
+			continue
+		}
+		envName := "HPCGAME_" + strings.ToUpper(strings.ReplaceAll(key.Name, ".", "_"))
+		if value, ok := os.LookupEnv(envName); ok && value != "" {
+			values[key.Name] = value
+		}
+	}
+	return values
+}
+
+// Settings is the effective configuration after merging every layer
+type Settings struct {
+	values  map[string]string
+	sources map[string]string
+}
+
+var cachedSettings *Settings
+
+// loadSettings merges built-in defaults, the project file, the user config
+// file, the active profile's config and environment overrides. Later layers win.
+func loadSettings() *Settings {
+	if cachedSettings != nil {
+		return cachedSettings
+	}
+
+	s := &Settings{values: map[string]string{}, sources: map[string]string{}}
+	s.merge(builtinDefaults, "built-in default")
+
+	if project := loadProject(); project != nil {
+		s.merge(project.values(), project.Path)
+	}
+
+	if path, err := userConfigPath(); err == nil {
+		cfg, err := readConfigFile(path)
+		if err != nil {
+			fmt.Printf("⚠️ Ignoring user config: %s\n", err)
+		} else {
+			s.merge(cfg.values(), path)
+		}
+	}
+
+	if path, err := profileConfigPath(currentProfile()); err == nil && path != "" {
+		cfg, err := readConfigFile(path)
+		if err != nil {
+			fmt.Printf("⚠️ Ignoring profile config: %s\n", err)
+		} else {
+			s.merge(cfg.values(), path)
+		}
+	}
+
+	env := envConfigValues()
+	for key, value := range env {
+		spec, _ := lookupConfigKey(key)
+		if spec.Validate != nil {
+			if err := spec.Validate(value); err != nil {
+				fmt.Printf("⚠️ Ignoring environment override for %s: %s\n", key, err)
+				delete(env, key)
+			}
+		}
+	}
+	s.merge(env, "environment")
+
+	cachedSettings = s
+	return s
+}
+
+func (s *Settings) merge(values map[string]string, source string) {
+	for key, value := range values {
+		s.values[key] = value
+		s.sources[key] = source
+	}
+}
+
+func (s *Settings) String(key string) string {
+	return s.values[key]
+}
+
+func (s *Settings) Int(key string) int {
+	n, _ := strconv.Atoi(s.values[key])
+	return n
+}
+
+func (s *Settings) Bool(key string) bool {
+	b, _ := strconv.ParseBool(s.values[key])
+	return b
+}
+
+func (s *Settings) List(key string) []string {
+	return splitList(s.values[key])
+}
+
+// Image returns the configured default image for a partition, if any
+func (s *Settings) Image(partition string) string {
+	if image := s.values["image."+partition]; image != "" {
+		return image
+	}
+	return s.values["image"]
+}
+
+func (s *Settings) keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// explainSettings prints every effective value together with its source
+func explainSettings() {
+	settings := loadSettings()
+
+	project := loadProject()
+	if project != nil {
+		fmt.Printf("Project file: %s\n", project.Path)
+	} else {
+		fmt.Printf("Project file: none (no %s found from the current directory upwards)\n", projectFileName)
+	}
+	if path, err := userConfigPath(); err == nil {
+		fmt.Printf("User config:  %s\n", path)
+	}
+	fmt.Printf("Profile:      %s\n", currentProfile())
+	fmt.Println()
+
+	fmt.Printf("%-20s %-30s %s\n", "KEY", "VALUE", "SOURCE")
+	for _, key := range settings.keys() {
+		fmt.Printf("%-20s %-30s %s\n", key, settings.String(key), settings.sources[key])
+	}
+
+	if project != nil && len(project.Sync) > 0 {
+		fmt.Printf("\nSync rules (from %s):\n", project.Path)
+		for _, rule := range project.Sync {
+			fmt.Printf("  %s -> %s", rule.Local, rule.Remote)
+			if len(rule.Exclude) > 0 {
+				fmt.Printf(" (exclude: %s)", strings.Join(rule.Exclude, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	if project != nil && len(project.Tasks) > 0 {
+		fmt.Printf("\nTasks (from %s):\n", project.Path)
+		for _, name := range project.taskNames() {
+			fmt.Printf("  %-15s %s\n", name, project.Tasks[name].Command)
+		}
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// outputJSON reports whether list commands should print JSON
+func outputJSON() bool {
+	return loadSettings().String("output") == "json"
+}
+
+// assumeYes is set by commands run with --yes
+var assumeYes bool
+
+// askConfirm asks a yes/no question unless --yes was given or confirmation is
+// disabled in the config
+func askConfirm(prompt string) bool {
+	if !assumeYes && !loadSettings().Bool("confirm") {
+		fmt.Printf("%s (y/n): y (confirmation disabled)\n", prompt)
+		return true
+	}
+	return askYesNo(prompt)
+}
+
+// askYesNo asks a yes/no question unless --yes was given. Overwrites and
+// deletions use it directly: confirm: false only skips the harmless questions.
+func askYesNo(prompt string) bool {
+	fmt.Printf("%s (y/n): ", prompt)
+	if assumeYes {
+		fmt.Println("y (--yes)")
+		return true
+	}
+
+	var response string
+	fmt.Scanln(&response)
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
+func handleConfigCommands() {
+	if len(os.Args) < 3 {
+		printConfigHelp()
+		return
+	}
+
+	path, err := userConfigPath()
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+
+	subCommand := os.Args[2]
+
+	switch subCommand {
+	case "list", "ls":
+		settings := loadSettings()
+		for _, key := range settings.keys() {
+			fmt.Printf("%s=%s\n", key, settings.String(key))
+		}
+	case "explain":
+		explainSettings()
+	case "get":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame config get KEY")
+			return
+		}
+		key := os.Args[3]
+		if _, ok := lookupConfigKey(key); !ok {
+			fmt.Printf("Unknown config key: %s\n", key)
+			return
+		}
+		fmt.Println(loadSettings().String(key))
+	case "set":
+		if len(os.Args) < 5 {
+			fmt.Println("Usage: hpcgame config set KEY VALUE")
+			return
+		}
+		cfg, err := readConfigFile(path)
+		if err != nil {
+			fmt.Printf("Failed to read config: %s\n", err)
+			return
+		}
+		if err := cfg.set(os.Args[3], os.Args[4]); err != nil {
+			fmt.Printf("Failed to set %s: %s\n", os.Args[3], err)
+			return
+		}
+		if err := writeConfigFile(path, cfg); err != nil {
+			fmt.Printf("Failed to save config: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ %s set to %s\n", os.Args[3], os.Args[4])
+	case "unset":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame config unset KEY")
+			return
+		}
+		cfg, err := readConfigFile(path)
+		if err != nil {
+			fmt.Printf("Failed to read config: %s\n", err)
+			return
+		}
+		if err := cfg.unset(os.Args[3]); err != nil {
+			fmt.Printf("Failed to unset %s: %s\n", os.Args[3], err)
+			return
+		}
+		if err := writeConfigFile(path, cfg); err != nil {
+			fmt.Printf("Failed to save config: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ %s unset\n", os.Args[3])
+	default:
+		fmt.Printf("Unknown config subcommand: %s\n", subCommand)
+		printConfigHelp()
+	}
+}
+
+func printConfigHelp() {
+	var keys strings.Builder
+	for _, key := range configKeys {
+		keys.WriteString(fmt.Sprintf("  %-20s %s\n", key.Name, key.Description))
+	}
+
+	helpText := `Config command usage:
+  hpcgame config list              Show effective configuration
+  hpcgame config explain           Show where each effective value comes from
+  hpcgame config get KEY           Show the effective value of KEY
+  hpcgame config set KEY VALUE     Save KEY in the user config file
+  hpcgame config unset KEY         Remove KEY from the user config file
+
+Keys:
+` + keys.String() + `
+Examples:
+  hpcgame config set partition x86
+  hpcgame config set image.gpu pytorch/pytorch
+  hpcgame config set confirm false
+
+Note:
+  - User config is stored in ~/.hpcgame/config.yaml
+  - A .hpcgame.yaml in the current directory or any parent sets project defaults,
+    which the user config overrides
+  - Every key can be overridden by HPCGAME_<KEY> environment variables (e.g. HPCGAME_PARTITION)
+  - HPCGAME_HOME relocates the ~/.hpcgame directory
+`
+	fmt.Println(helpText)
+}
+
+// flagPassed reports whether any of the named flags was given on the command line
+func flagPassed(fs *flag.FlagSet, names ...string) bool {
+	passed := false
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				passed = true
+			}
+		}
+	})
+	return passed
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Printf("Failed to encode JSON: %s\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
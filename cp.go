@@ -0,0 +1,761 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// cpProbeScript prints the available tools on the first line, then the kind
+// of the path (dir, file or none) and its size in bytes, followed by the
+// modification time, mode, uid and gid of a file if stat is available
+const cpProbeScript = `for c in tar zstd gzip sha256sum; do command -v $c >/dev/null 2>&1 && printf '%%s ' $c; done; echo
+p=%s
+if [ -d "$p" ]; then set -- $(du -sk "$p" 2>/dev/null); echo "dir $((${1:-0}*1024))"
+elif [ -e "$p" ]; then echo "file $(wc -c < "$p") $(stat -c '%%Y %%a %%u %%g' "$p" 2>/dev/null)"
+else echo "none 0"; fi
+`
+
+// cpTarScript runs tar with its output compressed, keeping the exit status
+// of tar rather than that of the compressor
+const cpTarScript = `{ s=$( { { %s; echo $? >&3; } | %s >&4; } 3>&1 ); exit $s; } 4>&1`
+
+// remotePath describes a path in a container, as found by cpProbeScript
+type remotePath struct {
+	tools   map[string]bool
+	kind    string
+	size    int64
+	modTime time.Time // zero if unknown
+	mode    os.FileMode
+	uid     int // -1 if unknown
+	gid     int
+}
+
+type cpOptions struct {
+	quiet     bool
+	compress  string
+	chunkSize int64
+	noResume  bool
+	noVerify  bool
+	archive   bool   // keep ownership, like cp -a
+	chown     string // USER[:GROUP] to give the copied files
+}
+
+func probeRemotePath(kubeconfigPath string, container string, p string) (*remotePath, error) {
+	var out strings.Builder
+	if err := containerExec(kubeconfigPath, container, fmt.Sprintf(cpProbeScript, remoteShellPath(p)), nil, &out); err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("unexpected output from container: %s", out.String())
+	}
+	info := &remotePath{tools: map[string]bool{}, uid: -1, gid: -1}
+	for _, tool := range strings.Fields(lines[0]) {
+		info.tools[tool] = true
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("unexpected output from container: %s", lines[1])
+	}
+	info.kind = fields[0]
+	info.size, _ = strconv.ParseInt(fields[1], 10, 64)
+	if len(fields) == 6 {
+		if seconds, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			info.modTime = time.Unix(seconds, 0)
+		}
+		if mode, err := strconv.ParseUint(fields[3], 8, 32); err == nil {
+			info.mode = os.FileMode(mode).Perm()
+		}
+		if uid, err := strconv.Atoi(fields[4]); err == nil {
+			info.uid = uid
+		}
+		if gid, err := strconv.Atoi(fields[5]); err == nil {
+			info.gid = gid
+		}
+	}
+	return info, nil
+}
+
+// chooseCompression picks the compression for a transfer: with auto, zstd if
+// the container has it, then gzip, then none
+func chooseCompression(requested string, tools map[string]bool) (string, error) {
+	switch requested {
+	case "", "auto":
+		for _, method := range []string{"zstd", "gzip"} {
+			if tools[method] {
+				return method, nil
+			}
+		}
+		return "none", nil
+	case "zstd", "gzip":
+		if !tools[requested] {
+			return "", fmt.Errorf("%s is not available in the container", requested)
+		}
+		return requested, nil
+	case "none":
+		return "none", nil
+	default:
+		return "", fmt.Errorf("unknown compression %q (use auto, zstd, gzip or none)", requested)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressWriter(w io.Writer, method string) (io.WriteCloser, error) {
+	switch method {
+	case "zstd":
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	case "gzip":
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+func decompressReader(r io.Reader, method string) (io.Reader, error) {
+	switch method {
+	case "zstd":
+		return zstd.NewReader(r)
+	case "gzip":
+		return gzip.NewReader(r)
+	default:
+		return r, nil
+	}
+}
+
+// remoteCompressCommand and remoteDecompressCommand are the container side
+// of the compression
+func remoteCompressCommand(method string) string {
+	switch method {
+	case "zstd":
+		return "zstd -1 -q -c"
+	case "gzip":
+		return "gzip -1 -c"
+	default:
+		return "cat"
+	}
+}
+
+func remoteDecompressCommand(method string) string {
+	switch method {
+	case "zstd":
+		return "zstd -d -q -c"
+	case "gzip":
+		return "gzip -d -c"
+	default:
+		return "cat"
+	}
+}
+
+// localTreeSize adds up the sizes of the regular files below root
+func localTreeSize(root string) int64 {
+	var total int64
+	filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// writeTarTree adds root to the archive under name, counting file contents
+// into counter
+func writeTarTree(tw *tar.Writer, root string, name string, counter io.Writer) error {
+	return filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			// Sockets and devices are skipped
+			return nil
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, io.TeeReader(f, counter), header.Size)
+		return err
+	})
+}
+
+// extractTarTree extracts an archive into dir. rename maps the archive names
+// to paths relative to dir; names it maps to "" are skipped. chown, if not
+// nil, is called with the owner recorded for each entry.
+func extractTarTree(r io.Reader, dir string, rename func(string) string, counter io.Writer, chown func(string, int, int)) error {
+	// Directory times are set last, as extracting into them changes them
+	type dirTime struct {
+		path    string
+		modTime time.Time
+	}
+	var dirs []dirTime
+	defer func() {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := rename(path.Clean(header.Name))
+		if rel == "" {
+			continue
+		}
+		rel = path.Clean(rel)
+		if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("refusing to write %s outside of %s", header.Name, dir)
+		}
+		if err := checkNoSymlinks(dir, rel); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		mode := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			os.Chmod(target, mode)
+			dirs = append(dirs, dirTime{target, header.ModTime})
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			// Replace a symlink instead of writing to where it points
+			if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				os.Remove(target)
+			}
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(io.MultiWriter(f, counter), tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			os.Chmod(target, mode)
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				fmt.Printf("⚠️ Cannot create symlink %s: %s\n", target, err)
+				continue
+			}
+		default:
+			continue
+		}
+		if chown != nil {
+			chown(target, header.Uid, header.Gid)
+		}
+	}
+}
+
+// finishCopy ends the progress bar, prints the summary and verifies a
+// single file copy
+func finishCopy(progress *transferProgress, err error, verify func() error, opts cpOptions) error {
+	summary := progress.finish()
+	if err != nil {
+		return err
+	}
+	if !opts.quiet {
+		fmt.Printf("✅ Copied %s\n", summary)
+	}
+	if verify != nil {
+		return verify()
+	}
+	return nil
+}
+
+// copyToContainer uploads a local file or directory
+func copyToContainer(kubeconfigPath string, source string, container string, destination string, opts cpOptions) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	remote, err := probeRemotePath(kubeconfigPath, container, destination)
+	if err != nil {
+		return err
+	}
+
+	// Like cp, copy into an existing directory, otherwise to the given name
+	dir, name := destination, filepath.Base(source)
+	if remote.kind != "dir" && !strings.HasSuffix(destination, "/") {
+		dir, name = path.Dir(destination), path.Base(destination)
+	}
+
+	if info.Mode().IsRegular() && !opts.noResume && info.Size() > opts.chunkSize<<20 {
+		return uploadResumable(kubeconfigPath, source, info, container, dir, name, remote, opts)
+	}
+	var verify func() error
+	if info.Mode().IsRegular() && remote.tools["sha256sum"] && !opts.noVerify {
+		verify = func() error {
+			return verifyCopy(kubeconfigPath, source, container, strings.TrimSuffix(dir, "/")+"/"+name, opts)
+		}
+	}
+
+	progress := newTransferProgress(localTreeSize(source), opts.quiet)
+	if !remote.tools["tar"] {
+		if info.IsDir() {
+			progress.finish()
+			return fmt.Errorf("tar is not available in container %s, only single files can be copied", container)
+		}
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		uid, gid := fileOwner(info)
+		script := fmt.Sprintf(`f=%s/%s; mkdir -p "$(dirname "$f")" && cat > "$f" && %s`,
+			remoteShellPath(dir), shellQuote(name), remoteFileAttrs(info.Mode(), info.ModTime(), uid, gid, opts))
+		err = containerExec(kubeconfigPath, container, script, io.TeeReader(f, progress), nil)
+		return finishCopy(progress, err, verify, opts)
+	}
+
+	method, err := chooseCompression(opts.compress, remote.tools)
+	if err != nil {
+		progress.finish()
+		return err
+	}
+	debugf("Compression: %s", method)
+
+	reader, writer := io.Pipe()
+	go func() {
+		compressed, err := compressWriter(io.MultiWriter(writer, wireCounter{progress}), method)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		tw := tar.NewWriter(compressed)
+		err = writeTarTree(tw, source, name, progress)
+		if err == nil {
+			err = tw.Close()
+		}
+		if err == nil {
+			err = compressed.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	script := fmt.Sprintf("mkdir -p %[1]s && cd %[1]s && %[2]s | %[3]s", remoteShellPath(dir), remoteDecompressCommand(method), remoteTarExtract(opts))
+	script += remoteChown(name, opts)
+	err = containerExec(kubeconfigPath, container, script, reader, nil)
+	reader.Close()
+	return finishCopy(progress, err, verify, opts)
+}
+
+// copyFromContainer downloads a file or directory from a container
+func copyFromContainer(kubeconfigPath string, container string, source string, destination string, opts cpOptions) error {
+	remote, err := probeRemotePath(kubeconfigPath, container, source)
+	if err != nil {
+		return err
+	}
+	if remote.kind == "none" {
+		return fmt.Errorf("%s:%s: no such file or directory", container, source)
+	}
+	chown, err := localChown(opts)
+	if err != nil {
+		return err
+	}
+
+	// Like cp, copy into an existing directory, otherwise to the given name
+	base := path.Base(strings.TrimRight(source, "/"))
+	dir, name := destination, base
+	if info, err := os.Stat(destination); (err != nil || !info.IsDir()) && !strings.HasSuffix(destination, string(filepath.Separator)) && !strings.HasSuffix(destination, "/") {
+		dir, name = filepath.Dir(destination), filepath.Base(destination)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if remote.kind == "file" && !opts.noResume && remote.size > opts.chunkSize<<20 {
+		return downloadResumable(kubeconfigPath, container, source, remote, filepath.Join(dir, name), chown, opts)
+	}
+	var verify func() error
+	if remote.kind == "file" && remote.tools["sha256sum"] && !opts.noVerify {
+		verify = func() error {
+			return verifyCopy(kubeconfigPath, filepath.Join(dir, name), container, source, opts)
+		}
+	}
+
+	progress := newTransferProgress(remote.size, opts.quiet)
+	if !remote.tools["tar"] {
+		if remote.kind == "dir" {
+			progress.finish()
+			return fmt.Errorf("tar is not available in container %s, only single files can be copied", container)
+		}
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			progress.finish()
+			return err
+		}
+		err = containerExec(kubeconfigPath, container, "cat -- "+remoteShellPath(source), nil, io.MultiWriter(f, progress))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			applyLocalAttrs(filepath.Join(dir, name), remote, chown)
+		}
+		return finishCopy(progress, err, verify, opts)
+	}
+
+	method, err := chooseCompression(opts.compress, remote.tools)
+	if err != nil {
+		progress.finish()
+		return err
+	}
+	debugf("Compression: %s", method)
+
+	// Directories are archived from inside, files from their parent
+	var tarCommand string
+	var rename func(string) string
+	if remote.kind == "dir" {
+		tarCommand = fmt.Sprintf("cd %s && tar -c -f - .", remoteShellPath(source))
+		rename = func(entry string) string {
+			return path.Join(name, entry)
+		}
+	} else {
+		tarCommand = fmt.Sprintf("cd %s && tar -c -f - %s", remoteShellPath(path.Dir(source)), shellQuote(base))
+		rename = func(entry string) string {
+			if entry != base {
+				return ""
+			}
+			return name
+		}
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		decompressed, err := decompressReader(io.TeeReader(reader, wireCounter{progress}), method)
+		if err == nil {
+			err = extractTarTree(decompressed, dir, rename, progress, chown)
+		}
+		// Drain the stream so that the container side can finish
+		io.Copy(io.Discard, reader)
+		done <- err
+	}()
+
+	script := fmt.Sprintf(cpTarScript, tarCommand, remoteCompressCommand(method))
+	err = containerExec(kubeconfigPath, container, script, nil, writer)
+	writer.CloseWithError(err)
+	if extractErr := <-done; err == nil {
+		err = extractErr
+	}
+	return finishCopy(progress, err, verify, opts)
+}
+
+// copyPath is a resolved cp argument
+type copyPath struct {
+	container string
+	path      string
+	remote    bool
+
+	// prefix and mount turn a path back into the argument form, such as
+	// volume:NAME:PATH for a path below mount in a helper pod
+	prefix string
+	mount  string
+}
+
+func (c copyPath) String() string {
+	if !c.remote {
+		return c.path
+	}
+	return c.prefix + strings.TrimPrefix(c.path, c.mount)
+}
+
+// resolveCopyPath splits a cp argument into a container and a path. For
+// volume:NAME:PATH, the container is one that mounts the volume, started
+// for the copy if needed.
+func resolveCopyPath(kubeconfigPath string, arg string, opts cpOptions) (copyPath, error) {
+	if volume, p, ok := parseVolumePath(arg); ok {
+		container, mount, err := startVolumeHelper(kubeconfigPath, volume, opts.quiet)
+		if err != nil {
+			return copyPath{}, err
+		}
+		target := path.Join(mount, p)
+		if strings.HasSuffix(p, "/") && target != "/" {
+			target += "/"
+		}
+		return copyPath{container: container, path: target, remote: true, prefix: volumePrefix + volume + ":", mount: mount}, nil
+	}
+	container, p, ok := splitContainerPath(arg)
+	if !ok {
+		return copyPath{path: expandHome(arg)}, nil
+	}
+	return copyPath{container: container, path: p, remote: true, prefix: container + ":"}, nil
+}
+
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// globQuote escapes a pattern for sh, leaving the glob characters and a
+// leading ~ to the shell
+func globQuote(pattern string) string {
+	var b strings.Builder
+	if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+		b.WriteString(`"$HOME"`)
+		pattern = strings.TrimPrefix(pattern, "~")
+	}
+	for _, r := range pattern {
+		switch {
+		case strings.ContainsRune("*?[]/._-", r),
+			r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// expandCopySource expands the globs in a cp source. Remote patterns are
+// expanded by the shell in the container; local ones usually were already
+// expanded by the user's shell, but not on Windows.
+func expandCopySource(kubeconfigPath string, arg string, opts cpOptions) ([]copyPath, error) {
+	source, err := resolveCopyPath(kubeconfigPath, arg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !hasGlob(source.path) {
+		return []copyPath{source}, nil
+	}
+
+	var matches []string
+	if source.remote {
+		script := fmt.Sprintf(`for f in %s; do if [ -e "$f" ] || [ -L "$f" ]; then printf '%%s\n' "$f"; fi; done`, globQuote(source.path))
+		var out strings.Builder
+		if err := containerExec(kubeconfigPath, source.container, script, nil, &out); err != nil {
+			return nil, err
+		}
+		matches = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if out.Len() == 0 {
+			matches = nil
+		}
+	} else {
+		if _, err := os.Lstat(source.path); err == nil {
+			return []copyPath{source}, nil
+		}
+		if matches, err = filepath.Glob(source.path); err != nil {
+			return nil, fmt.Errorf("%s: %s", arg, err)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s: no matches found", arg)
+	}
+
+	expanded := make([]copyPath, len(matches))
+	for i, match := range matches {
+		expanded[i] = source
+		expanded[i].path = match
+	}
+	return expanded, nil
+}
+
+func printCopyHelp() {
+	fmt.Println("Usage: hpcgame cp [OPTIONS] SOURCE... DEST")
+	fmt.Println("Examples:")
+	fmt.Println("  hpcgame cp ./local-file.txt container:/path/to/file.txt")
+	fmt.Println("  hpcgame cp container:/path/to/file.txt ./local-copy.txt")
+	fmt.Println("  hpcgame cp ./dataset container:/partition-data/")
+	fmt.Println("  hpcgame cp a.txt b.txt ./dir container:/partition-data/")
+	fmt.Println("  hpcgame cp 'container:/results/*.csv' ./results/")
+	fmt.Println("  hpcgame cp container-a:/data/out.bin container-b:/data/")
+	fmt.Println("  hpcgame cp ./dataset volume:my-volume:/datasets/")
+	fmt.Println()
+	fmt.Println("With several sources, DEST is a directory. Patterns in container paths are")
+	fmt.Println("expanded in the container; quote them so that the local shell leaves them.")
+	fmt.Println("Permissions and modification times are kept.")
+	fmt.Println()
+	fmt.Println("volume:NAME:PATH copies through a container that mounts the volume, or a")
+	fmt.Println("temporary helper pod that is deleted afterwards.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -q, --quiet          Do not show progress or a summary")
+	fmt.Println("  -a, --archive        Also keep the owner of files, where permitted")
+	fmt.Println("  --chown USER[:GROUP] Give the copied files this owner")
+	fmt.Println("  --compress METHOD    auto (default), zstd, gzip or none")
+	fmt.Printf("  --chunk-size MIB     Copy files larger than this in resumable chunks (default %d)\n", defaultChunkSize)
+	fmt.Println("  --no-resume          Copy large files in one stream")
+	fmt.Println("  --no-verify          Do not compare SHA-256 checksums after copying a file")
+}
+
+func copyFiles() {
+	cpCmd := flag.NewFlagSet("cp", flag.ContinueOnError)
+	quiet := cpCmd.Bool("quiet", false, "Do not show progress or a summary")
+	cpCmd.BoolVar(quiet, "q", false, "Do not show progress or a summary (short)")
+	archive := cpCmd.Bool("archive", false, "Also keep the owner of files, where permitted")
+	cpCmd.BoolVar(archive, "a", false, "Also keep the owner of files, where permitted (short)")
+	chown := cpCmd.String("chown", "", "Give the copied files this owner, USER[:GROUP]")
+	compress := cpCmd.String("compress", "auto", "Compression: auto, zstd, gzip or none")
+	chunkSize := cpCmd.Int64("chunk-size", defaultChunkSize, "Copy files larger than this many MiB in resumable chunks")
+	noResume := cpCmd.Bool("no-resume", false, "Copy large files in one stream")
+	noVerify := cpCmd.Bool("no-verify", false, "Do not compare SHA-256 checksums after copying a file")
+	cpCmd.Usage = printCopyHelp
+	args := parseInterspersed(cpCmd, os.Args[2:])
+
+	if len(args) < 2 {
+		fmt.Println("Source and destination required")
+		printCopyHelp()
+		exit(exitUsage)
+	}
+
+	sources := args[:len(args)-1]
+	destination := args[len(args)-1]
+
+	// Handle containers with missing paths
+	if strings.Contains(destination, ":") && strings.HasSuffix(destination, ":") && !strings.HasPrefix(destination, volumePrefix) {
+		containerName := strings.TrimSuffix(destination, ":")
+		destination = containerName + ":~/"
+		fmt.Printf("⚠️ No destination path specified, copying to home directory of container %s\n", containerName)
+	}
+
+	_, _, destRemote := splitContainerPath(destination)
+	for _, source := range sources {
+		// Check for invalid source path
+		if strings.Contains(source, ":") && strings.HasSuffix(source, ":") && !strings.HasPrefix(source, volumePrefix) {
+			fmt.Println("❌ Error: Source file path cannot be empty")
+			fmt.Println("Usage: hpcgame cp SOURCE... DEST")
+			exit(exitUsage)
+		}
+		if _, _, sourceRemote := splitContainerPath(source); !sourceRemote && !destRemote {
+			fmt.Println("❌ At least one of SOURCE and DEST must be CONTAINER:PATH or volume:NAME:PATH")
+			exit(exitUsage)
+		}
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+
+	if *chunkSize <= 0 {
+		fmt.Println("❌ --chunk-size must be positive")
+		exit(exitUsage)
+	}
+	opts := cpOptions{
+		quiet:     *quiet,
+		compress:  *compress,
+		chunkSize: *chunkSize,
+		noResume:  *noResume,
+		noVerify:  *noVerify,
+		archive:   *archive,
+		chown:     *chown,
+	}
+
+	dest, err := resolveCopyPath(kubeconfigPath, destination, opts)
+	if err != nil {
+		fmt.Printf("❌ Failed to copy files: %s\n", err)
+		exit(exitFailure)
+	}
+
+	unmatched := 0
+	var copies []copyPath
+	for _, source := range sources {
+		expanded, err := expandCopySource(kubeconfigPath, source, opts)
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			unmatched++
+			continue
+		}
+		copies = append(copies, expanded...)
+	}
+
+	// Like cp, several sources are copied into a directory
+	if len(copies)+unmatched > 1 {
+		if dest.remote {
+			if !strings.HasSuffix(dest.path, "/") {
+				dest.path += "/"
+			}
+		} else {
+			if info, err := os.Stat(dest.path); err == nil && !info.IsDir() {
+				fmt.Printf("❌ %s is not a directory\n", dest.path)
+				exit(exitUsage)
+			}
+			if !strings.HasSuffix(dest.path, string(filepath.Separator)) {
+				dest.path += string(filepath.Separator)
+			}
+		}
+	}
+
+	failed := unmatched
+	for _, source := range copies {
+		if !opts.quiet {
+			fmt.Printf("Copying: %s -> %s\n", source, dest)
+		}
+		var err error
+		switch {
+		case source.remote && dest.remote:
+			err = copyBetweenContainers(kubeconfigPath, source.container, source.path, dest.container, dest.path, opts)
+		case dest.remote:
+			err = copyToContainer(kubeconfigPath, source.path, dest.container, dest.path, opts)
+		default:
+			err = copyFromContainer(kubeconfigPath, source.container, source.path, dest.path, opts)
+		}
+		if err != nil {
+			fmt.Printf("❌ Failed to copy %s: %s\n", source, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		if total := len(copies) + unmatched; total > 1 {
+			fmt.Printf("❌ %d of %d copies failed\n", failed, total)
+		}
+		exit(exitFailure)
+	}
+}
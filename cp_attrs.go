@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remoteFileAttrs returns a script that gives "$f" in the container a mode,
+// modification time and, with -a or --chown, an owner. Unknown values are
+// zero, or -1 for the owner, and left alone.
+func remoteFileAttrs(mode os.FileMode, modTime time.Time, uid int, gid int, opts cpOptions) string {
+	script := ":"
+	if mode != 0 {
+		script = fmt.Sprintf(`chmod %o "$f"`, mode.Perm())
+	}
+	if !modTime.IsZero() {
+		// touch -d @SECONDS is not supported everywhere, the time is best effort
+		script += fmt.Sprintf(` && { touch -d @%d "$f" 2>/dev/null || :; }`, modTime.Unix())
+	}
+	if opts.chown != "" {
+		return script + ` && chown ` + shellQuote(opts.chown) + ` "$f"`
+	}
+	if opts.archive && uid >= 0 {
+		script += fmt.Sprintf(` && { chown %d:%d "$f" 2>/dev/null || :; }`, uid, gid)
+	}
+	return script
+}
+
+// fileOwner returns the uid and gid of a local file, or -1 where files have
+// no such owner
+func fileOwner(info os.FileInfo) (int, int) {
+	if runtime.GOOS == "windows" {
+		return -1, -1
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return -1, -1
+	}
+	return header.Uid, header.Gid
+}
+
+// remoteChown returns a script that sets the owner of a tree copied into the
+// current directory of the container with --chown, or "" without it
+func remoteChown(name string, opts cpOptions) string {
+	if opts.chown == "" {
+		return ""
+	}
+	return fmt.Sprintf(" && chown -R %s %s", shellQuote(opts.chown), shellQuote(name))
+}
+
+// remoteTarExtract is the tar command that unpacks an upload in the
+// container; ownership is kept only with -a
+func remoteTarExtract(opts cpOptions) string {
+	if opts.archive {
+		return "tar -x -p -f -"
+	}
+	return "tar -x -o -p -f -"
+}
+
+// lookupOwner resolves USER[:GROUP], by name or number, on this machine.
+// A missing group is returned as -1, which leaves it unchanged.
+func lookupOwner(spec string) (int, int, error) {
+	userName, groupName, _ := strings.Cut(spec, ":")
+	uid, gid := -1, -1
+	if userName != "" {
+		id, err := strconv.Atoi(userName)
+		if err != nil {
+			u, lookupErr := user.Lookup(userName)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			if id, err = strconv.Atoi(u.Uid); err != nil {
+				return 0, 0, fmt.Errorf("user %s has no numeric ID", userName)
+			}
+		}
+		uid = id
+	}
+	if groupName != "" {
+		id, err := strconv.Atoi(groupName)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(groupName)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			if id, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, fmt.Errorf("group %s has no numeric ID", groupName)
+			}
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
+
+// localChown returns how downloaded files get their owner: the one recorded
+// in the archive with -a, the one given with --chown, or nil to leave the
+// owner as the current user
+func localChown(opts cpOptions) (func(target string, uid int, gid int), error) {
+	if opts.chown != "" {
+		uid, gid, err := lookupOwner(opts.chown)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --chown %s: %s", opts.chown, err)
+		}
+		warned := false
+		return func(target string, _ int, _ int) {
+			if err := os.Lchown(target, uid, gid); err != nil && !warned {
+				fmt.Printf("⚠️ Cannot set the owner of %s: %s\n", target, err)
+				warned = true
+			}
+		}, nil
+	}
+	if opts.archive {
+		// Like cp -a, ownership is kept where permitted, usually only as root
+		return func(target string, uid int, gid int) {
+			os.Lchown(target, uid, gid)
+		}, nil
+	}
+	return nil, nil
+}
+
+// applyLocalAttrs gives a file downloaded without tar the mode, time and
+// owner found by probeRemotePath
+func applyLocalAttrs(target string, remote *remotePath, chown func(string, int, int)) {
+	if remote.mode != 0 {
+		os.Chmod(target, remote.mode)
+	}
+	if !remote.modTime.IsZero() {
+		os.Chtimes(target, remote.modTime, remote.modTime)
+	}
+	if chown != nil {
+		chown(target, remote.uid, remote.gid)
+	}
+}
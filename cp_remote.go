@@ -0,0 +1,441 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	volumePrefix     = "volume:"
+	volumeHelperPath = "/volume"
+
+	// volumeHelperTimeout is how long to wait for the helper pod to start
+	volumeHelperTimeout = "180s"
+)
+
+// volumeNamePattern is a Kubernetes object name (DNS-1123 subdomain), which
+// also keeps the name from changing the helper pod manifest
+var volumeNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+// volumeHelpers remembers the container used for each volume, so that one
+// cp command starts at most one helper pod per volume
+var (
+	volumeHelpers     = map[string]volumeHelper{}
+	volumeHelpersLock sync.Mutex
+)
+
+type volumeHelper struct {
+	container string
+	mount     string
+}
+
+// parseVolumePath splits volume:NAME:PATH; PATH defaults to the volume root
+func parseVolumePath(arg string) (volume string, p string, ok bool) {
+	if !strings.HasPrefix(arg, volumePrefix) {
+		return "", "", false
+	}
+	volume, p, _ = strings.Cut(strings.TrimPrefix(arg, volumePrefix), ":")
+	if p == "" {
+		p = "/"
+	}
+	return volume, p, true
+}
+
+// volumeMount finds a running container that mounts the volume and returns
+// its name and the mount path
+func volumeMount(kubeconfigPath string, volume string) (string, string, error) {
+	var stderr bytes.Buffer
+	cmd := kubectlCommand(kubeconfigPath, "get", "pods", "-o", "json")
+	cmd.Stderr = watchCredentials(&stderr)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get container list: %s\n%s", err, stderr.String())
+	}
+
+	var podList struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				Containers []struct {
+					VolumeMounts []struct {
+						Name      string `json:"name"`
+						MountPath string `json:"mountPath"`
+					} `json:"volumeMounts"`
+				} `json:"containers"`
+				Volumes []struct {
+					Name                  string `json:"name"`
+					PersistentVolumeClaim struct {
+						ClaimName string `json:"claimName"`
+					} `json:"persistentVolumeClaim"`
+				} `json:"volumes"`
+			} `json:"spec"`
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &podList); err != nil {
+		return "", "", fmt.Errorf("failed to parse container list: %s", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != "Running" || len(pod.Spec.Containers) == 0 {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim.ClaimName != volume {
+				continue
+			}
+			for _, mount := range pod.Spec.Containers[0].VolumeMounts {
+				if mount.Name == vol.Name {
+					return pod.Metadata.Name, mount.MountPath, nil
+				}
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// volumeHelperPartition picks the partition for a helper pod: the one whose
+// default volume it is, otherwise the configured or the first partition
+func volumeHelperPartition(volume string) (Partition, error) {
+	partitions := getPartitions()
+	if len(partitions) == 0 {
+		return Partition{}, fmt.Errorf("failed to get partition information")
+	}
+	for _, p := range partitions {
+		if volume == strings.ReplaceAll(p.Name, "_", "-")+"-default-pvc" {
+			return p, nil
+		}
+	}
+	if name := loadSettings().String("partition"); name != "" {
+		for _, p := range partitions {
+			if p.Name == name {
+				return p, nil
+			}
+		}
+	}
+	return partitions[0], nil
+}
+
+// startVolumeHelper makes a volume reachable for cp. If a running container
+// mounts it, that container is used; otherwise a small helper pod mounting
+// the volume is started, which is deleted when hpcgame exits, also if it is
+// interrupted.
+func startVolumeHelper(kubeconfigPath string, volume string, quiet bool) (container string, mount string, err error) {
+	if volume == "" {
+		return "", "", fmt.Errorf("volume name required: volume:NAME:PATH")
+	}
+	if len(volume) > 253 || !volumeNamePattern.MatchString(volume) {
+		return "", "", fmt.Errorf("invalid volume name %q", volume)
+	}
+
+	volumeHelpersLock.Lock()
+	defer volumeHelpersLock.Unlock()
+	if helper, ok := volumeHelpers[volume]; ok {
+		return helper.container, helper.mount, nil
+	}
+	defer func() {
+		if err == nil {
+			volumeHelpers[volume] = volumeHelper{container, mount}
+		}
+	}()
+
+	container, mount, err = volumeMount(kubeconfigPath, volume)
+	if err != nil {
+		return "", "", err
+	}
+	if container != "" {
+		if !quiet {
+			fmt.Printf("Using container %s, which mounts volume %s at %s\n", container, volume, mount)
+		}
+		return container, mount, nil
+	}
+
+	partition, err := volumeHelperPartition(volume)
+	if err != nil {
+		return "", "", err
+	}
+	image := loadSettings().Image(partition.Name)
+	if image == "" && len(partition.Images) > 0 {
+		image = partition.Images[0]
+	}
+	if image == "" {
+		return "", "", fmt.Errorf("no image available for a helper pod in partition %s", partition.Name)
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", "", err
+	}
+	name := "hpcgame-cp-" + hex.EncodeToString(suffix)
+
+	// The deadline removes the pod even if hpcgame is killed before cleaning up
+	yamlConfig := fmt.Sprintf(`apiVersion: v1
+kind: Pod
+metadata:
+  name: %s
+  labels:
+    hpcgame.lcpu.dev/helper: cp
+spec:
+  nodeSelector:
+    hpc.lcpu.dev/partition: %s
+  containers:
+  - name: container
+    image: %s
+    command: ["sleep", "infinity"]
+    resources:
+      requests:
+        cpu: 100m
+        memory: 256Mi
+      limits:
+        cpu: 1000m
+        memory: 1Gi
+    volumeMounts:
+    - name: volume
+      mountPath: %s
+  volumes:
+  - name: volume
+    persistentVolumeClaim:
+      claimName: %s
+  restartPolicy: Never
+  terminationGracePeriodSeconds: 0
+  activeDeadlineSeconds: 86400
+`, name, partition.Name, image, volumeHelperPath, volume)
+	if verbose() {
+		fmt.Printf("Generated YAML config:\n%s\n", yamlConfig)
+	}
+
+	if !quiet {
+		fmt.Printf("Starting helper pod %s for volume %s...\n", name, volume)
+	}
+	var stderr bytes.Buffer
+	cmd := kubectlCommand(kubeconfigPath, "apply", "-f", "-")
+	cmd.Stdin = strings.NewReader(yamlConfig)
+	cmd.Stderr = watchCredentials(&stderr)
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("failed to start helper pod: %s\n%s", err, stderr.String())
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			debugf("Deleting helper pod %s", name)
+			cmd := kubectlCommand(kubeconfigPath, "delete", "pod", name, "--wait=false")
+			var stderr bytes.Buffer
+			cmd.Stderr = watchCredentials(&stderr)
+			if err := cmd.Run(); err != nil {
+				fmt.Printf("⚠️ Failed to delete helper pod %s: %s\n%s", name, err, stderr.String())
+			}
+		})
+	}
+	atExit(cleanup)
+
+	stderr.Reset()
+	cmd = kubectlCommand(kubeconfigPath, "wait", "--for=condition=Ready", "pod/"+name, "--timeout="+volumeHelperTimeout)
+	cmd.Stderr = watchCredentials(&stderr)
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", "", fmt.Errorf("helper pod %s did not start: %s\n%s"+
+			"If volume %s is ReadWriteOnce, it may be mounted by a container on another node", name, err, stderr.String(), volume)
+	}
+	return name, volumeHelperPath, nil
+}
+
+// relayTar copies the entries of an archive to another, renaming them like
+// extractTarTree; names that rename maps to "" are skipped
+func relayTar(r io.Reader, tw *tar.Writer, rename func(string) string, counter io.Writer) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := rename(path.Clean(header.Name))
+		if rel == "" {
+			continue
+		}
+		rel = path.Clean(rel)
+		if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("refusing to write %s outside of the destination", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			rel += "/"
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, io.TeeReader(tr, counter)); err != nil {
+			return err
+		}
+	}
+}
+
+// copyBetweenContainers streams a file or directory from one container to
+// another through hpcgame, without a copy on the local disk
+func copyBetweenContainers(kubeconfigPath string, sourceContainer string, source string, destContainer string, destination string, opts cpOptions) error {
+	from, err := probeRemotePath(kubeconfigPath, sourceContainer, source)
+	if err != nil {
+		return err
+	}
+	if from.kind == "none" {
+		return fmt.Errorf("%s:%s: no such file or directory", sourceContainer, source)
+	}
+	to, err := probeRemotePath(kubeconfigPath, destContainer, destination)
+	if err != nil {
+		return err
+	}
+
+	// Like cp, copy into an existing directory, otherwise to the given name
+	base := path.Base(strings.TrimRight(source, "/"))
+	dir, name := destination, base
+	if to.kind != "dir" && !strings.HasSuffix(destination, "/") {
+		dir, name = path.Dir(destination), path.Base(destination)
+	}
+	target := strings.TrimSuffix(dir, "/") + "/" + name
+
+	var verify func() error
+	if from.kind == "file" && from.tools["sha256sum"] && to.tools["sha256sum"] && !opts.noVerify {
+		verify = func() error {
+			if !opts.quiet {
+				fmt.Println("Verifying SHA-256...")
+			}
+			sourceSum, err := remoteSHA256(kubeconfigPath, sourceContainer, remoteShellPath(source))
+			if err != nil {
+				return fmt.Errorf("failed to compute SHA-256 in container %s: %s", sourceContainer, err)
+			}
+			destSum, err := remoteSHA256(kubeconfigPath, destContainer, remoteShellPath(target))
+			if err != nil {
+				return fmt.Errorf("failed to compute SHA-256 in container %s: %s", destContainer, err)
+			}
+			if sourceSum != destSum {
+				return fmt.Errorf("SHA-256 mismatch: %s:%s is %s, but %s:%s is %s", sourceContainer, source, sourceSum, destContainer, target, destSum)
+			}
+			if !opts.quiet {
+				fmt.Printf("✅ SHA-256 verified: %s\n", sourceSum)
+			}
+			return nil
+		}
+	}
+
+	progress := newTransferProgress(from.size, opts.quiet)
+	if !from.tools["tar"] || !to.tools["tar"] {
+		if from.kind == "dir" {
+			progress.finish()
+			return fmt.Errorf("tar is not available in both containers, only single files can be copied")
+		}
+		reader, writer := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			script := fmt.Sprintf(`f=%s/%s; mkdir -p "$(dirname "$f")" && cat > "$f" && %s`,
+				remoteShellPath(dir), shellQuote(name), remoteFileAttrs(from.mode, from.modTime, from.uid, from.gid, opts))
+			err := containerExec(kubeconfigPath, destContainer, script, reader, nil)
+			reader.CloseWithError(err)
+			done <- err
+		}()
+		err = containerExec(kubeconfigPath, sourceContainer, "cat -- "+remoteShellPath(source), nil, io.MultiWriter(writer, progress))
+		writer.CloseWithError(err)
+		if destErr := <-done; err == nil {
+			err = destErr
+		}
+		return finishCopy(progress, err, verify, opts)
+	}
+
+	sourceMethod, err := chooseCompression(opts.compress, from.tools)
+	if err != nil {
+		progress.finish()
+		return err
+	}
+	destMethod, err := chooseCompression(opts.compress, to.tools)
+	if err != nil {
+		progress.finish()
+		return err
+	}
+	debugf("Compression: %s from %s, %s to %s", sourceMethod, sourceContainer, destMethod, destContainer)
+
+	// Directories are archived from inside, files from their parent
+	var tarCommand string
+	var rename func(string) string
+	if from.kind == "dir" {
+		tarCommand = fmt.Sprintf("cd %s && tar -c -f - .", remoteShellPath(source))
+		rename = func(entry string) string {
+			return path.Join(name, entry)
+		}
+	} else {
+		tarCommand = fmt.Sprintf("cd %s && tar -c -f - %s", remoteShellPath(path.Dir(source)), shellQuote(base))
+		rename = func(entry string) string {
+			if entry != base {
+				return ""
+			}
+			return name
+		}
+	}
+
+	// source container -> sourceReader -> relay -> destReader -> destination container
+	sourceReader, sourceWriter := io.Pipe()
+	destReader, destWriter := io.Pipe()
+
+	relayDone := make(chan error, 1)
+	go func() {
+		err := func() error {
+			decompressed, err := decompressReader(io.TeeReader(sourceReader, wireCounter{progress}), sourceMethod)
+			if err != nil {
+				return err
+			}
+			compressed, err := compressWriter(destWriter, destMethod)
+			if err != nil {
+				return err
+			}
+			tw := tar.NewWriter(compressed)
+			if err := relayTar(decompressed, tw, rename, progress); err != nil {
+				return err
+			}
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return compressed.Close()
+		}()
+		destWriter.CloseWithError(err)
+		// Drain the stream so that the source container can finish
+		io.Copy(io.Discard, sourceReader)
+		relayDone <- err
+	}()
+
+	destDone := make(chan error, 1)
+	go func() {
+		script := fmt.Sprintf("mkdir -p %[1]s && cd %[1]s && %[2]s | %[3]s", remoteShellPath(dir), remoteDecompressCommand(destMethod), remoteTarExtract(opts))
+		script += remoteChown(name, opts)
+		err := containerExec(kubeconfigPath, destContainer, script, destReader, nil)
+		// Unblock the relay if the destination stopped reading
+		destReader.CloseWithError(fmt.Errorf("container %s stopped reading", destContainer))
+		destDone <- err
+	}()
+
+	script := fmt.Sprintf(cpTarScript, tarCommand, remoteCompressCommand(sourceMethod))
+	err = containerExec(kubeconfigPath, sourceContainer, script, nil, sourceWriter)
+	sourceWriter.CloseWithError(err)
+	relayErr := <-relayDone
+	destErr := <-destDone
+	if err == nil {
+		err = destErr
+	}
+	if err == nil {
+		err = relayErr
+	}
+	return finishCopy(progress, err, verify, opts)
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChunkSize = 64 // MiB
+	partSuffix       = ".hpcgame-part"
+	transfersDir     = "transfers"
+	chunkRetries     = 5
+)
+
+// transferState records how far a chunked transfer got, so that running the
+// same cp again continues from the last confirmed chunk
+type transferState struct {
+	Direction   string    `json:"direction"`
+	Local       string    `json:"local"`
+	Container   string    `json:"container"`
+	Remote      string    `json:"remote"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time,omitempty"` // of the local source of an upload
+	SHA256      string    `json:"sha256,omitempty"`   // of the remote source of a download
+	Transferred int64     `json:"transferred"`
+	Updated     time.Time `json:"updated"`
+}
+
+func transferStatePath(direction string, local string, container string, remote string) (string, error) {
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(direction + "\x00" + local + "\x00" + container + "\x00" + remote))
+	return filepath.Join(dir, transfersDir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadTransferState(path string) *transferState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	state := &transferState{}
+	if json.Unmarshal(data, state) != nil {
+		return nil
+	}
+	return state
+}
+
+func (s *transferState) save(path string) {
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+		os.WriteFile(path, data, 0600)
+	}
+}
+
+// remoteSHA256 hashes a file in the container; p is already quoted for sh
+func remoteSHA256(kubeconfigPath string, container string, p string) (string, error) {
+	var out strings.Builder
+	if err := containerExec(kubeconfigPath, container, "sha256sum < "+p, nil, &out); err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected output from sha256sum")
+	}
+	return fields[0], nil
+}
+
+// verifyCopy compares the SHA-256 of a local file and a file in the container
+func verifyCopy(kubeconfigPath string, localPath string, container string, remote string, opts cpOptions) error {
+	if !opts.quiet {
+		fmt.Println("Verifying SHA-256...")
+	}
+	localSum, err := hashFile(localPath, "sha256sum")
+	if err != nil {
+		return err
+	}
+	remoteSum, err := remoteSHA256(kubeconfigPath, container, remoteShellPath(remote))
+	if err != nil {
+		return fmt.Errorf("failed to compute SHA-256 in the container: %s", err)
+	}
+	if localSum != remoteSum {
+		return fmt.Errorf("SHA-256 mismatch: %s is %s, but %s:%s is %s", localPath, localSum, container, remote, remoteSum)
+	}
+	if !opts.quiet {
+		fmt.Printf("✅ SHA-256 verified: %s\n", localSum)
+	}
+	return nil
+}
+
+// withRetries runs a chunk transfer, retrying with a growing delay
+func withRetries(opts cpOptions, transfer func() error) error {
+	delay := time.Second
+	var err error
+	for attempt := 0; attempt <= chunkRetries; attempt++ {
+		if attempt > 0 {
+			if !opts.quiet {
+				fmt.Printf("\n⚠️ Chunk failed: %s, retrying in %s\n", err, delay)
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = transfer(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// uploadResumable uploads a large file in chunks appended to a part file
+// next to the destination, which is renamed once the SHA-256 matches
+func uploadResumable(kubeconfigPath string, source string, info os.FileInfo, container string, dir string, name string, remote *remotePath, opts cpOptions) error {
+	destination := strings.TrimSuffix(dir, "/") + "/" + name
+	vars := fmt.Sprintf(`d=%s; f="$d"/%s; p="$f%s"`, remoteShellPath(dir), shellQuote(name), partSuffix)
+
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	statePath, err := transferStatePath("upload", absSource, container, destination)
+	if err != nil {
+		return err
+	}
+	state := loadTransferState(statePath)
+	resume := state != nil && state.Size == info.Size() && state.ModTime.Equal(info.ModTime())
+	if !resume {
+		state = &transferState{Direction: "upload", Local: absSource, Container: container, Remote: destination, Size: info.Size(), ModTime: info.ModTime()}
+	}
+
+	// What was appended to the part file is a prefix of the source, even if
+	// the last chunk was not confirmed, so the upload continues at its size
+	script := vars + `; mkdir -p "$d" && { [ -f "$p" ] || : > "$p"; } && wc -c < "$p"`
+	if !resume {
+		script = vars + `; mkdir -p "$d" && : > "$p" && echo 0`
+	}
+	remoteSize := func(script string) (int64, error) {
+		var out strings.Builder
+		if err := containerExec(kubeconfigPath, container, script, nil, &out); err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	}
+	offset, err := remoteSize(script)
+	if err != nil {
+		return err
+	}
+	if offset > info.Size() {
+		if offset, err = remoteSize(vars + `; : > "$p" && echo 0`); err != nil {
+			return err
+		}
+	}
+	if offset > 0 && !opts.quiet {
+		fmt.Printf("Resuming upload at %s of %s\n", formatBytes(offset), formatBytes(info.Size()))
+	}
+
+	method, err := chooseCompression(opts.compress, remote.tools)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunkSize := opts.chunkSize << 20
+	progress := newTransferProgress(info.Size(), opts.quiet)
+	progress.resumeAt(offset)
+	for offset < info.Size() {
+		n := min(chunkSize, info.Size()-offset)
+		err := withRetries(opts, func() error {
+			progress.done.Store(offset)
+			reader, writer := io.Pipe()
+			go func() {
+				compressed, err := compressWriter(io.MultiWriter(writer, wireCounter{progress}), method)
+				if err == nil {
+					_, err = io.Copy(compressed, io.TeeReader(io.NewSectionReader(f, offset, n), progress))
+				}
+				if err == nil {
+					err = compressed.Close()
+				}
+				writer.CloseWithError(err)
+			}()
+			var out strings.Builder
+			err := containerExec(kubeconfigPath, container, fmt.Sprintf(`%s; %s >> "$p" && wc -c < "$p"`, vars, remoteDecompressCommand(method)), reader, &out)
+			reader.Close()
+			if err != nil {
+				// The next attempt continues from whatever arrived
+				if size, sizeErr := remoteSize(vars + `; wc -c < "$p"`); sizeErr == nil && size >= offset && size <= offset+n {
+					n -= size - offset
+					offset = size
+				}
+				return err
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+			if err != nil || size != offset+n {
+				return fmt.Errorf("the container has %s instead of %s", strings.TrimSpace(out.String()), strconv.FormatInt(offset+n, 10))
+			}
+			offset = size
+			return nil
+		})
+		if err != nil {
+			progress.finish()
+			state.save(statePath)
+			return fmt.Errorf("%s; run the same command again to resume", err)
+		}
+		state.Transferred = offset
+		state.save(statePath)
+	}
+	summary := progress.finish()
+
+	if remote.tools["sha256sum"] && !opts.noVerify {
+		if !opts.quiet {
+			fmt.Println("Verifying SHA-256...")
+		}
+		localSum, err := hashFile(source, "sha256sum")
+		if err != nil {
+			return err
+		}
+		remoteSum, err := remoteSHA256(kubeconfigPath, container, fmt.Sprintf(`%s%s`, remoteShellPath(destination), partSuffix))
+		if err != nil {
+			return fmt.Errorf("failed to compute SHA-256 in the container: %s", err)
+		}
+		if localSum != remoteSum {
+			os.Remove(statePath)
+			containerExec(kubeconfigPath, container, vars+`; rm -f "$p"`, nil, nil)
+			return fmt.Errorf("SHA-256 mismatch: %s is %s, but the upload is %s; the partial upload was discarded", source, localSum, remoteSum)
+		}
+		if !opts.quiet {
+			fmt.Printf("✅ SHA-256 verified: %s\n", localSum)
+		}
+	} else if !opts.quiet && !opts.noVerify {
+		fmt.Println("⚠️ sha256sum is not available in the container, the upload was not verified")
+	}
+
+	uid, gid := fileOwner(info)
+	if err := containerExec(kubeconfigPath, container, fmt.Sprintf(`%s; mv -f "$p" "$f" && %s`, vars, remoteFileAttrs(info.Mode(), info.ModTime(), uid, gid, opts)), nil, nil); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	if !opts.quiet {
+		fmt.Printf("✅ Copied %s\n", summary)
+	}
+	return nil
+}
+
+// downloadResumable downloads a large file in chunks appended to a local
+// part file, which is renamed once the SHA-256 matches
+func downloadResumable(kubeconfigPath string, container string, source string, remote *remotePath, target string, chown func(string, int, int), opts cpOptions) error {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	statePath, err := transferStatePath("download", absTarget, container, source)
+	if err != nil {
+		return err
+	}
+
+	// The checksum identifies the version of the file being resumed
+	remoteSum := ""
+	if remote.tools["sha256sum"] {
+		if !opts.quiet {
+			fmt.Println("Computing SHA-256 in the container...")
+		}
+		if remoteSum, err = remoteSHA256(kubeconfigPath, container, remoteShellPath(source)); err != nil {
+			return fmt.Errorf("failed to compute SHA-256 in the container: %s", err)
+		}
+	}
+
+	part := absTarget + partSuffix
+	state := loadTransferState(statePath)
+	var offset int64
+	if state != nil && state.Size == remote.size && state.SHA256 == remoteSum && remoteSum != "" {
+		if info, err := os.Stat(part); err == nil && info.Size() <= remote.size {
+			offset = info.Size()
+		}
+	} else {
+		state = &transferState{Direction: "download", Local: absTarget, Container: container, Remote: source, Size: remote.size, SHA256: remoteSum}
+	}
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if offset > 0 && !opts.quiet {
+		fmt.Printf("Resuming download at %s of %s\n", formatBytes(offset), formatBytes(remote.size))
+	}
+
+	method, err := chooseCompression(opts.compress, remote.tools)
+	if err != nil {
+		return err
+	}
+
+	chunkSize := opts.chunkSize << 20
+	progress := newTransferProgress(remote.size, opts.quiet)
+	progress.resumeAt(offset)
+	for offset < remote.size {
+		n := min(chunkSize, remote.size-offset)
+		err := withRetries(opts, func() error {
+			progress.done.Store(offset)
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+
+			reader, writer := io.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				decompressed, err := decompressReader(io.TeeReader(reader, wireCounter{progress}), method)
+				if err == nil {
+					_, err = io.Copy(io.MultiWriter(f, progress), decompressed)
+				}
+				io.Copy(io.Discard, reader)
+				done <- err
+			}()
+			script := fmt.Sprintf("tail -c +%d %s | head -c %d | %s", offset+1, remoteShellPath(source), n, remoteCompressCommand(method))
+			err := containerExec(kubeconfigPath, container, script, nil, writer)
+			writer.CloseWithError(err)
+			if copyErr := <-done; err == nil {
+				err = copyErr
+			}
+			if err != nil {
+				return err
+			}
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if info.Size() != offset+n {
+				return fmt.Errorf("received %s instead of %s", formatBytes(info.Size()-offset), formatBytes(n))
+			}
+			offset += n
+			return nil
+		})
+		if err != nil {
+			progress.finish()
+			state.Transferred = offset
+			state.save(statePath)
+			return fmt.Errorf("%s; run the same command again to resume", err)
+		}
+		state.Transferred = offset
+		state.save(statePath)
+	}
+	summary := progress.finish()
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if remoteSum != "" && !opts.noVerify {
+		if !opts.quiet {
+			fmt.Println("Verifying SHA-256...")
+		}
+		localSum, err := hashFile(part, "sha256sum")
+		if err != nil {
+			return err
+		}
+		if localSum != remoteSum {
+			os.Remove(part)
+			os.Remove(statePath)
+			return fmt.Errorf("SHA-256 mismatch: %s:%s is %s, but the download is %s; the partial download was discarded", container, source, remoteSum, localSum)
+		}
+		if !opts.quiet {
+			fmt.Printf("✅ SHA-256 verified: %s\n", localSum)
+		}
+	} else if !opts.quiet && !opts.noVerify {
+		fmt.Println("⚠️ sha256sum is not available in the container, the download was not verified")
+	}
+
+	if err := os.Rename(part, absTarget); err != nil {
+		return err
+	}
+	applyLocalAttrs(absTarget, remote, chown)
+	os.Remove(statePath)
+	if !opts.quiet {
+		fmt.Printf("✅ Copied %s\n", summary)
+	}
+	return nil
+}
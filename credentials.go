@@ -0,0 +1,265 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// credentialsRejected is set once kubectl reported that the cluster refused
+// the saved credentials. Parallel kubectl runs may set it.
+var credentialsRejected atomic.Bool
+
+var tokenExpiryWarned bool
+
+// kubeconfigInUse is the kubeconfig returned by getKubeConfig
+var kubeconfigInUse string
+
+// kubectlAuthError matches the lines kubectl itself prints when the API
+// server refuses the credentials
+var kubectlAuthError = regexp.MustCompile(`(?m)^(error: You must be logged in to the server|Error from server \(Unauthorized\))`)
+
+// credentialWatcher forwards kubectl's stderr and remembers whether it
+// contained an authentication error
+type credentialWatcher struct {
+	w    io.Writer
+	tail []byte
+	exec bool // stderr of kubectl exec, mixed with the container's
+}
+
+func (c *credentialWatcher) Write(p []byte) (int, error) {
+	// Keep the end of the previous write, the message may be split
+	data := append(append([]byte{}, c.tail...), p...)
+	if c.exec && kubectlAuthError.Match(data) || !c.exec && isUnauthorized(string(data)) {
+		credentialsRejected.Store(true)
+	}
+	if len(data) > 64 {
+		data = data[len(data)-64:]
+	}
+	c.tail = data
+
+	if c.w == nil {
+		return len(p), nil
+	}
+	return c.w.Write(p)
+}
+
+// watchCredentials wraps the stderr of a kubectl command. A nil w discards
+// the output, like leaving cmd.Stderr unset.
+func watchCredentials(w io.Writer) io.Writer {
+	return &credentialWatcher{w: w}
+}
+
+// watchExecCredentials wraps the stderr of kubectl exec, which also carries
+// the stderr of the command in the container. Only kubectl's own errors
+// count, not an "Unauthorized" printed by, say, curl in the container.
+func watchExecCredentials(w io.Writer) io.Writer {
+	return &credentialWatcher{w: w, exec: true}
+}
+
+// loginCommand returns the command that refreshes the active profile's credentials
+func loginCommand() string {
+	if profile := currentProfile(); profile != defaultProfile {
+		return fmt.Sprintf("hpcgame --profile %s login", profile)
+	}
+	return "hpcgame login"
+}
+
+// reportCredentialProblems explains what to do after kubectl was refused
+func reportCredentialProblems() {
+	if !credentialsRejected.Swap(false) {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr)
+	reason := "The cluster rejected your credentials, your token is invalid or has expired."
+	if expiry, ok := kubeconfigTokenExpiry(kubeconfigInUse); ok && time.Now().After(expiry) {
+		reason = fmt.Sprintf("The cluster rejected your credentials, your token expired at %s.", expiry.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(os.Stderr, "❌ %s\n", reason)
+	fmt.Fprintf(os.Stderr, "Generate a new kubeconfig at %s and run '%s'\n", tokensURL, loginCommand())
+}
+
+// warnTokenExpiry prints a notice when the saved token has expired or
+// expires within tokenExpiryWarning. It is shown once per invocation.
+func warnTokenExpiry(kubeconfigPath string) {
+	if tokenExpiryWarned {
+		return
+	}
+	tokenExpiryWarned = true
+
+	expiry, ok := kubeconfigTokenExpiry(kubeconfigPath)
+	if !ok {
+		return
+	}
+	remaining := time.Until(expiry)
+	switch {
+	case remaining <= 0:
+		fmt.Fprintf(os.Stderr, "⚠️ Your token expired at %s\n", expiry.Format("2006-01-02 15:04"))
+	case remaining < tokenExpiryWarning:
+		fmt.Fprintf(os.Stderr, "⚠️ Your token expires in %s (%s)\n", formatRemaining(remaining), expiry.Format("2006-01-02 15:04"))
+	default:
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Generate a new kubeconfig at %s and run '%s'\n", tokensURL, loginCommand())
+}
+
+func formatRemaining(d time.Duration) string {
+	if d >= 24*time.Hour {
+		days := int(d / (24 * time.Hour))
+		hours := int(d%(24*time.Hour)) / int(time.Hour)
+		return fmt.Sprintf("%dd%dh", days, hours)
+	}
+	return d.Round(time.Minute).String()
+}
+
+// extractCredentials returns the user entry of a kubeconfig's current
+// context. A bare token is accepted as well.
+func extractCredentials(input string) (map[interface{}]interface{}, *Kubeconfig, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, nil, fmt.Errorf("no credentials provided")
+	}
+	if !strings.ContainsAny(input, " \t\n:") {
+		return map[interface{}]interface{}{"token": input}, nil, nil
+	}
+
+	config, err := parseKubeconfig([]byte(input))
+	if err != nil {
+		return nil, nil, err
+	}
+	var user *NamedUser
+	if ctx := config.context(""); ctx != nil {
+		user = config.user(ctx.Context.User)
+	}
+	if user == nil && len(config.Users) == 1 {
+		user = &config.Users[0]
+	}
+	if user == nil || len(user.User) == 0 {
+		return nil, nil, fmt.Errorf("no user credentials found in the kubeconfig")
+	}
+
+	credentials := map[interface{}]interface{}{}
+	for key, value := range user.User {
+		credentials[key] = value
+	}
+	return credentials, config, nil
+}
+
+func credentialsToken(credentials map[interface{}]interface{}) string {
+	token, _ := credentials["token"].(string)
+	return token
+}
+
+// clusterServer returns the API server of a kubeconfig's current context
+func (k *Kubeconfig) clusterServer() string {
+	ctx := k.context("")
+	if ctx == nil {
+		return ""
+	}
+	cluster := k.cluster(ctx.Context.Cluster)
+	if cluster == nil {
+		return ""
+	}
+	server, _ := cluster.Cluster["server"].(string)
+	return server
+}
+
+func login() {
+	loginCmd := flag.NewFlagSet("login", flag.ContinueOnError)
+	file := loginCmd.String("kubeconfig-file", "", "Read the new kubeconfig from file instead of stdin")
+	env := loginCmd.String("kubeconfig-env", "", "Read the new kubeconfig from the named environment variable")
+	token := loginCmd.String("token", "", "Use this bearer token instead of a kubeconfig")
+	loginCmd.Usage = func() {
+		fmt.Println("Usage: hpcgame login [OPTIONS]")
+		fmt.Println("Replace the credentials in the saved kubeconfig, keeping cluster, context and namespace settings.")
+		fmt.Println("Options:")
+		loginCmd.PrintDefaults()
+	}
+	parseFlags(loginCmd, os.Args[2:])
+
+	profile := currentProfile()
+	stored, err := readStoredKubeconfig(profile)
+	if err != nil {
+		fmt.Printf("Failed to read saved kubeconfig: %s\n", err)
+		fmt.Println("Run 'hpcgame install' to set up a new kubeconfig")
+		exit(exitFailure)
+	}
+	saved, err := parseKubeconfig(stored)
+	if err != nil {
+		fmt.Printf("Failed to read saved kubeconfig: %s\n", err)
+		exit(exitFailure)
+	}
+	ctx := saved.context("")
+	if ctx == nil {
+		fmt.Printf("Current context %q not found in the saved kubeconfig, run 'hpcgame install --force'\n", saved.CurrentContext)
+		exit(exitFailure)
+	}
+	user := saved.user(ctx.Context.User)
+	if user == nil {
+		fmt.Printf("User %q not found in the saved kubeconfig, run 'hpcgame install --force'\n", ctx.Context.User)
+		exit(exitFailure)
+	}
+
+	var input string
+	switch {
+	case *token != "":
+		input = *token
+	case *env != "":
+		input = os.Getenv(*env)
+	case *file != "" && *file != "-":
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Printf("❌ Failed to read kubeconfig: %s\n", err)
+			exit(exitInvalidKubeconfig)
+		}
+		input = string(data)
+	default:
+		fmt.Printf("Updating credentials of profile %s\n", profile)
+		input = getKubeconfigFromUser()
+	}
+
+	credentials, fresh, err := extractCredentials(input)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitInvalidKubeconfig)
+	}
+	if fresh != nil && fresh.clusterServer() != "" && fresh.clusterServer() != saved.clusterServer() {
+		fmt.Printf("❌ The new kubeconfig is for %s, but profile %s uses %s\n", fresh.clusterServer(), profile, saved.clusterServer())
+		fmt.Println("Use 'hpcgame install --force' or 'hpcgame profile add' for a different cluster")
+		exit(exitInvalidKubeconfig)
+	}
+
+	user.User = map[string]interface{}{}
+	for key, value := range credentials {
+		user.User[fmt.Sprint(key)] = value
+	}
+	data, err := yaml.Marshal(saved)
+	if err != nil {
+		fmt.Printf("Failed to encode kubeconfig: %s\n", err)
+		exit(exitFailure)
+	}
+
+	if !validateKubeconfig(string(data)) {
+		fmt.Println("❌ The new credentials were not accepted, the saved kubeconfig was not changed")
+		exit(exitInvalidKubeconfig)
+	}
+
+	savedPath, err := writeStoredKubeconfig(profile, data)
+	if err != nil {
+		fmt.Printf("Failed to save kubeconfig: %s\n", err)
+		exit(exitFailure)
+	}
+
+	fmt.Printf("✅ Credentials of profile %s updated in %s\n", profile, savedPath)
+	if expiry, ok := jwtExpiry(credentialsToken(credentials)); ok {
+		fmt.Printf("The new token is valid until %s\n", expiry.Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type doctorReport struct {
+	Profile string        `json:"profile"`
+	Checks  []doctorCheck `json:"checks"`
+	quiet   bool
+}
+
+func (r *doctorReport) add(name string, status string, format string, args ...interface{}) {
+	check := doctorCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)}
+	r.Checks = append(r.Checks, check)
+	if r.quiet {
+		return
+	}
+
+	icon := map[string]string{checkPass: "✅", checkWarn: "⚠️", checkFail: "❌", checkSkip: "➖"}[status]
+	fmt.Printf("%s %-6s %-22s %s\n", icon, strings.ToUpper(status), name, check.Message)
+}
+
+func (r *doctorReport) count(status string) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func doctor() {
+	doctorCmd := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	jsonFlag := doctorCmd.Bool("json", false, "Print a machine-readable JSON report")
+	parseFlags(doctorCmd, os.Args[2:])
+
+	report := &doctorReport{Profile: currentProfile(), quiet: *jsonFlag || outputJSON()}
+	if !report.quiet {
+		printProfileHeader()
+	}
+
+	runDoctorChecks(report)
+
+	if report.quiet {
+		printJSON(report)
+	} else {
+		fmt.Printf("\n%d passed, %d warnings, %d failed\n", report.count(checkPass), report.count(checkWarn), report.count(checkFail))
+	}
+
+	if report.count(checkFail) > 0 {
+		exit(exitFailure)
+	}
+}
+
+func runDoctorChecks(r *doctorReport) {
+	// kubectl
+	kubectlPath, err := exec.LookPath(kubectlBinary())
+	if err != nil {
+		r.add("kubectl", checkFail, "kubectl not found, run 'hpcgame install' or 'hpcgame kubectl install'")
+	} else if versions, _ := getKubectlVersions(""); versions.Client != "" {
+		r.add("kubectl", checkPass, "%s (%s)", versions.Client, kubectlPath)
+	} else {
+		r.add("kubectl", checkWarn, "found at %s but could not determine its version", kubectlPath)
+	}
+
+	// kubeconfig
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		r.add("kubeconfig", checkFail, "failed to get user home directory: %s", err)
+		return
+	}
+	kubeconfigPath := filepath.Join(dir, kubeconfigFile)
+	encrypted := kubeconfigEncrypted(currentProfile())
+	storedPath := kubeconfigPath
+	if encrypted {
+		storedPath = filepath.Join(dir, encryptedKubeconfigFile)
+	}
+	info, err := os.Stat(storedPath)
+	if err != nil {
+		r.add("kubeconfig", checkFail, "%s not found, run 'hpcgame install'", storedPath)
+		return
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm != 0600 {
+		r.add("kubeconfig", checkWarn, "%s has permissions %04o, run 'chmod 600 %s'", storedPath, perm, storedPath)
+	} else if encrypted {
+		r.add("kubeconfig", checkPass, "%s (encrypted)", storedPath)
+	} else {
+		r.add("kubeconfig", checkPass, "%s", storedPath)
+	}
+
+	// Later checks need the decrypted kubeconfig
+	if encrypted {
+		data, err := readStoredKubeconfig(currentProfile())
+		if err == nil {
+			kubeconfigPath, err = materializeKubeconfig(data)
+		}
+		if err != nil {
+			r.add("kubeconfig format", checkFail, "cannot decrypt: %s", err)
+			return
+		}
+	}
+
+	config, err := readKubeconfig(kubeconfigPath)
+	if err != nil {
+		r.add("kubeconfig format", checkFail, "%s", err)
+	} else if config.context("") == nil {
+		r.add("kubeconfig format", checkFail, "current context %q not found", config.CurrentContext)
+	}
+
+	// Token expiry
+	if expiry, ok := kubeconfigTokenExpiry(kubeconfigPath); !ok {
+		r.add("token expiry", checkSkip, "token carries no expiry information")
+	} else if remaining := time.Until(expiry); remaining <= 0 {
+		r.add("token expiry", checkFail, "token expired at %s, get a new kubeconfig from %s and run '%s'", expiry.Format(time.RFC3339), tokensURL, loginCommand())
+	} else if remaining < tokenExpiryWarning {
+		r.add("token expiry", checkWarn, "token expires at %s (in %s), renew it with '%s'", expiry.Format(time.RFC3339), formatRemaining(remaining), loginCommand())
+	} else {
+		r.add("token expiry", checkPass, "token valid until %s", expiry.Format(time.RFC3339))
+	}
+
+	if kubectlPath == "" {
+		r.add("API access", checkSkip, "kubectl not available")
+		return
+	}
+
+	// API reachability and authentication
+	namespace := resolveNamespace(kubeconfigPath)
+	cmd := kubectlCommand(kubeconfigPath, "get", "pods", "--request-timeout=15s", "-o", "name")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		switch {
+		case isUnauthorized(message):
+			r.add("API access", checkFail, "authentication failed, the token is invalid or expired; get a new kubeconfig from %s and run '%s'", tokensURL, loginCommand())
+		case strings.Contains(message, "Forbidden") || strings.Contains(message, "forbidden"):
+			r.add("API access", checkFail, "not allowed to list containers in namespace %s", namespace)
+		default:
+			r.add("API access", checkFail, "cannot reach the cluster: %s", firstLine(message))
+		}
+		return
+	}
+	r.add("API access", checkPass, "cluster reachable and credentials accepted")
+	r.add("namespace", checkPass, "%s (from %s)", namespace, resolvedNamespaceSource)
+
+	if versions, err := getKubectlVersions(kubeconfigPath); err == nil {
+		if kubectlSkewSupported(versions.Client, versions.Server) {
+			r.add("version skew", checkPass, "kubectl %s, cluster %s", versions.Client, versions.Server)
+		} else {
+			r.add("version skew", checkWarn, "kubectl %s is too far from cluster %s, run 'hpcgame kubectl check'", versions.Client, versions.Server)
+		}
+	}
+
+	// Partition cache
+	partitions := checkPartitionCache(r, dir)
+
+	// Default volumes and storage classes for each partition
+	if len(partitions) > 0 {
+		checkDefaultVolumes(r, kubeconfigPath, partitions)
+		checkStorageClasses(r, kubeconfigPath, partitions)
+	}
+
+	// VSCode extensions
+	checkVSCodeExtensions(r)
+}
+
+// checkPartitionCache checks the cached partition list without refreshing it
+func checkPartitionCache(r *doctorReport, dir string) []Partition {
+	data, err := os.ReadFile(filepath.Join(dir, "partitions.json"))
+	if err != nil {
+		r.add("partition cache", checkWarn, "no cached partition list, run 'hpcgame lspart' to download it")
+		return nil
+	}
+
+	var partitions []Partition
+	if err := json.Unmarshal(data, &partitions); err != nil {
+		r.add("partition cache", checkFail, "cannot parse partitions.json: %s (delete it and run 'hpcgame lspart')", err)
+		return nil
+	}
+
+	lastUpdate := 0
+	if data, err := os.ReadFile(filepath.Join(dir, "partition_last_update")); err == nil {
+		lastUpdate, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	age := time.Since(time.Unix(int64(lastUpdate), 0))
+	if lastUpdate == 0 {
+		r.add("partition cache", checkWarn, "%d partitions, last update time unknown (refreshed on next use)", len(partitions))
+	} else if age > 24*time.Hour {
+		r.add("partition cache", checkWarn, "%d partitions, last updated %s ago (refreshed on next use)", len(partitions), age.Round(time.Hour))
+	} else {
+		r.add("partition cache", checkPass, "%d partitions, updated %s ago", len(partitions), age.Round(time.Minute))
+	}
+	return partitions
+}
+
+func checkDefaultVolumes(r *doctorReport, kubeconfigPath string, partitions []Partition) {
+	output, err := kubectlCommand(kubeconfigPath, "get", "pvc", "-o", "json").Output()
+	if err != nil {
+		r.add("default volumes", checkWarn, "failed to list volumes: %s", err)
+		return
+	}
+
+	var pvcList struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &pvcList); err != nil {
+		r.add("default volumes", checkWarn, "failed to parse volume list: %s", err)
+		return
+	}
+
+	phases := map[string]string{}
+	for _, pvc := range pvcList.Items {
+		phases[pvc.Metadata.Name] = pvc.Status.Phase
+	}
+
+	for _, partition := range partitions {
+		name := fmt.Sprintf("%s-default-pvc", strings.ReplaceAll(partition.Name, "_", "-"))
+		check := "volume " + partition.Name
+		switch phase, ok := phases[name]; {
+		case !ok:
+			r.add(check, checkWarn, "%s not created yet (created with the first container)", name)
+		case phase == "Bound":
+			r.add(check, checkPass, "%s is Bound", name)
+		default:
+			r.add(check, checkWarn, "%s is %s", name, phase)
+		}
+	}
+}
+
+func checkStorageClasses(r *doctorReport, kubeconfigPath string, partitions []Partition) {
+	output, err := kubectlCommand(kubeconfigPath, "get", "storageclass", "-o", "json").Output()
+	if err != nil {
+		r.add("storage classes", checkSkip, "not allowed to list storage classes")
+		return
+	}
+
+	var scList struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &scList); err != nil {
+		r.add("storage classes", checkWarn, "failed to parse storage class list: %s", err)
+		return
+	}
+
+	present := map[string]bool{}
+	for _, sc := range scList.Items {
+		present[sc.Metadata.Name] = true
+	}
+
+	var missing []string
+	for _, partition := range partitions {
+		name := fmt.Sprintf("%s-default-sc", strings.ReplaceAll(partition.Name, "_", "-"))
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		r.add("storage classes", checkWarn, "missing: %s", strings.Join(missing, ", "))
+	} else {
+		r.add("storage classes", checkPass, "default storage class present for all %d partitions", len(partitions))
+	}
+}
+
+func checkVSCodeExtensions(r *doctorReport) {
+	if _, err := exec.LookPath("code"); err != nil {
+		r.add("VSCode extensions", checkSkip, "'code' command not found")
+		return
+	}
+
+	output, err := exec.Command("code", "--list-extensions").Output()
+	if err != nil {
+		r.add("VSCode extensions", checkWarn, "failed to list extensions: %s", err)
+		return
+	}
+
+	installed := map[string]bool{}
+	for _, ext := range strings.Fields(string(output)) {
+		installed[strings.ToLower(ext)] = true
+	}
+	var missing []string
+	for _, ext := range vscodeExtensions {
+		if !installed[strings.ToLower(ext)] {
+			missing = append(missing, ext)
+		}
+	}
+	if len(missing) > 0 {
+		r.add("VSCode extensions", checkWarn, "missing %s, run 'code --install-extension NAME'", strings.Join(missing, ", "))
+	} else {
+		r.add("VSCode extensions", checkPass, "all recommended extensions installed")
+	}
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
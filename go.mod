@@ -1,3 +1,13 @@
 module github.com/lcpu-club/hpcgame-kube-cli
 
 go 1.23.5
+
+require (
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/crypto v0.36.0
+	golang.org/x/term v0.30.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/sys v0.31.0 // indirect
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const hpcgameIgnoreFile = ".hpcgameignore"
+
+// ignorePattern is one line of a .gitignore style file
+type ignorePattern struct {
+	pattern  string
+	base     string // directory of the ignore file, relative to the sync root
+	source   string // the ignore file, empty for --exclude
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher decides which paths below a sync root are skipped. Paths use
+// forward slashes and are relative to the root.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+	loaded   map[string]time.Time // ignore files read, by modification time
+}
+
+func newIgnoreMatcher(excludes []string) *ignoreMatcher {
+	m := &ignoreMatcher{loaded: map[string]time.Time{}}
+	m.add("", ".git/")
+	for _, exclude := range excludes {
+		m.add("", exclude)
+	}
+	return m
+}
+
+// add parses one pattern line defined in the directory base
+func (m *ignoreMatcher) add(base string, line string) {
+	if p, ok := parseIgnorePattern(base, line); ok {
+		m.patterns = append(m.patterns, p)
+	}
+}
+
+func parseIgnorePattern(base string, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, `\`)
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash anywhere but at the end anchors the pattern to its directory
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+	p.pattern = line
+	return p, true
+}
+
+// load reads an ignore file, if it exists, for the directory base. A file
+// read before is only read again when it changed, and its patterns then
+// replace the old ones in place.
+func (m *ignoreMatcher) load(file string, base string) {
+	var modTime time.Time
+	previous, seen := m.loaded[file]
+	if info, err := os.Stat(file); err == nil {
+		modTime = info.ModTime()
+	} else if !seen {
+		return
+	}
+	if seen && previous.Equal(modTime) {
+		return
+	}
+	m.loaded[file] = modTime
+
+	var patterns []ignorePattern
+	if f, err := os.Open(file); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if p, ok := parseIgnorePattern(base, scanner.Text()); ok {
+				p.source = file
+				patterns = append(patterns, p)
+			}
+		}
+		f.Close()
+	}
+
+	// Keep the position, which decides what overrides what
+	var kept []ignorePattern
+	at := -1
+	for _, p := range m.patterns {
+		if p.source != file {
+			kept = append(kept, p)
+		} else if at < 0 {
+			at = len(kept)
+		}
+	}
+	if at < 0 {
+		at = len(kept)
+	}
+	m.patterns = append(append(kept[:at:at], patterns...), kept[at:]...)
+}
+
+// ignored reports whether rel or one of its parent directories is excluded
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match applies the patterns to rel alone; the last matching pattern wins
+func (m *ignoreMatcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, p.base+"/")
+		}
+		var matched bool
+		if p.anchored {
+			matched = globMatch(strings.Split(p.pattern, "/"), strings.Split(target, "/"))
+		} else {
+			matched, _ = path.Match(p.pattern, path.Base(target))
+		}
+		if matched {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// globMatch matches path segments, where ** matches any number of segments
+func globMatch(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if globMatch(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return globMatch(pattern[1:], segments[1:])
+}
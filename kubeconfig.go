@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// tokensURL is where users generate a new kubeconfig
+const tokensURL = "https://hpcgame.pku.edu.cn/kube/_/ui/#/tokens/"
+
+// tokenExpiryWarning is how long before expiry a token is reported
+const tokenExpiryWarning = 3 * 24 * time.Hour
+
+// Kubeconfig is the subset of a kubeconfig file hpcgame reads and rewrites.
+// Cluster and user bodies are kept as maps so unknown fields survive a rewrite.
+type Kubeconfig struct {
+	APIVersion     string                 `yaml:"apiVersion"`
+	Kind           string                 `yaml:"kind"`
+	CurrentContext string                 `yaml:"current-context"`
+	Preferences    map[string]interface{} `yaml:"preferences,omitempty"`
+	Clusters       []NamedCluster         `yaml:"clusters"`
+	Contexts       []NamedContext         `yaml:"contexts"`
+	Users          []NamedUser            `yaml:"users"`
+}
+
+type NamedCluster struct {
+	Name    string                 `yaml:"name"`
+	Cluster map[string]interface{} `yaml:"cluster"`
+}
+
+type NamedContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster   string `yaml:"cluster"`
+		User      string `yaml:"user"`
+		Namespace string `yaml:"namespace,omitempty"`
+	} `yaml:"context"`
+}
+
+type NamedUser struct {
+	Name string                 `yaml:"name"`
+	User map[string]interface{} `yaml:"user"`
+}
+
+func parseKubeconfig(data []byte) (*Kubeconfig, error) {
+	config := &Kubeconfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %s", err)
+	}
+	return config, nil
+}
+
+func readKubeconfig(path string) (*Kubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKubeconfig(data)
+}
+
+// context returns the named context, or the current one if name is empty
+func (k *Kubeconfig) context(name string) *NamedContext {
+	if name == "" {
+		name = k.CurrentContext
+	}
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == name {
+			return &k.Contexts[i]
+		}
+	}
+	return nil
+}
+
+func (k *Kubeconfig) user(name string) *NamedUser {
+	for i := range k.Users {
+		if k.Users[i].Name == name {
+			return &k.Users[i]
+		}
+	}
+	return nil
+}
+
+func (k *Kubeconfig) cluster(name string) *NamedCluster {
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == name {
+			return &k.Clusters[i]
+		}
+	}
+	return nil
+}
+
+// currentToken returns the bearer token of the current context's user
+func (k *Kubeconfig) currentToken() string {
+	ctx := k.context("")
+	if ctx == nil {
+		return ""
+	}
+	user := k.user(ctx.Context.User)
+	if user == nil {
+		return ""
+	}
+	token, _ := user.User["token"].(string)
+	return token
+}
+
+// jwtExpiry returns the exp claim of a JWT. ok is false if the token is not
+// a JWT or has no expiry.
+func jwtExpiry(token string) (expiry time.Time, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == "" {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// kubeconfigTokenExpiry returns when the token in a kubeconfig file expires
+func kubeconfigTokenExpiry(path string) (time.Time, bool) {
+	config, err := readKubeconfig(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return jwtExpiry(config.currentToken())
+}
+
+// isUnauthorized reports whether kubectl output indicates rejected credentials
+func isUnauthorized(output string) bool {
+	return strings.Contains(output, "Unauthorized") ||
+		strings.Contains(output, "You must be logged in to the server")
+}
+
+// extractContext returns a kubeconfig holding only the named context (the
+// current one if name is empty) with its cluster and user
+func (k *Kubeconfig) extractContext(name string) (*Kubeconfig, error) {
+	ctx := k.context(name)
+	if ctx == nil {
+		if name == "" {
+			return nil, fmt.Errorf("the kubeconfig has no current context, choose one with --context")
+		}
+		var names []string
+		for _, c := range k.Contexts {
+			names = append(names, c.Name)
+		}
+		return nil, fmt.Errorf("context %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+	cluster := k.cluster(ctx.Context.Cluster)
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster %q of context %q not found", ctx.Context.Cluster, ctx.Name)
+	}
+	user := k.user(ctx.Context.User)
+	if user == nil {
+		return nil, fmt.Errorf("user %q of context %q not found", ctx.Context.User, ctx.Name)
+	}
+
+	return &Kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		CurrentContext: ctx.Name,
+		Clusters:       []NamedCluster{*cluster},
+		Contexts:       []NamedContext{*ctx},
+		Users:          []NamedUser{*user},
+	}, nil
+}
+
+// inlineFiles replaces certificate and key file references with their
+// contents, so the kubeconfig still works after it is copied elsewhere.
+// Relative paths are resolved against baseDir.
+func (k *Kubeconfig) inlineFiles(baseDir string) error {
+	inline := func(fields map[string]interface{}, key string) error {
+		path, ok := fields[key].(string)
+		if !ok || path == "" {
+			return nil
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", key, err)
+		}
+		delete(fields, key)
+		fields[key+"-data"] = base64.StdEncoding.EncodeToString(data)
+		return nil
+	}
+
+	for _, cluster := range k.Clusters {
+		if err := inline(cluster.Cluster, "certificate-authority"); err != nil {
+			return err
+		}
+	}
+	for _, user := range k.Users {
+		for _, key := range []string{"client-certificate", "client-key"} {
+			if err := inline(user.User, key); err != nil {
+				return err
+			}
+		}
+		if path, ok := user.User["tokenFile"].(string); ok && path != "" && !filepath.IsAbs(path) {
+			user.User["tokenFile"] = filepath.Join(baseDir, path)
+		}
+	}
+	return nil
+}
+
+// importKubeconfigContext reduces a kubeconfig to a single context with
+// certificate files inlined
+func importKubeconfigContext(kubeconfig string, context string, baseDir string) (string, error) {
+	config, err := parseKubeconfig([]byte(kubeconfig))
+	if err != nil {
+		return "", err
+	}
+	extracted, err := config.extractContext(context)
+	if err != nil {
+		return "", err
+	}
+	if err := extracted.inlineFiles(baseDir); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(extracted)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Importing context %s (cluster %s, user %s)\n", extracted.CurrentContext, extracted.Clusters[0].Name, extracted.Users[0].Name)
+	return string(data), nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultKubectlConfig returns the kubeconfig kubectl uses by default: the
+// first entry of $KUBECONFIG, or ~/.kube/config
+func defaultKubectlConfig() (string, error) {
+	if list := filepath.SplitList(os.Getenv("KUBECONFIG")); len(list) > 0 && list[0] != "" {
+		return list[0], nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// exportKubeconfig merges the active profile's context into the kubectl
+// config, so that kubectl, k9s or Lens can use it directly
+func exportKubeconfig() {
+	exportCmd := flag.NewFlagSet("kubeconfig export", flag.ContinueOnError)
+	target := exportCmd.String("kubeconfig", "", "Kubeconfig to merge into (default: first entry of $KUBECONFIG or ~/.kube/config)")
+	name := exportCmd.String("name", "", "Name of the exported context, cluster and user (default: hpcgame, or hpcgame-PROFILE)")
+	use := exportCmd.Bool("use", false, "Make the exported context the current context")
+	parseFlags(exportCmd, os.Args[3:])
+
+	profile := currentProfile()
+	if *name == "" {
+		*name = "hpcgame"
+		if profile != defaultProfile {
+			*name = "hpcgame-" + profile
+		}
+	}
+	if *target == "" {
+		path, err := defaultKubectlConfig()
+		if err != nil {
+			fmt.Printf("Failed to get user home directory: %s\n", err)
+			return
+		}
+		*target = path
+	}
+	*target = expandHome(*target)
+
+	if kubeconfigEncrypted(profile) && !askConfirm(fmt.Sprintf("The kubeconfig of profile %s is encrypted, but %s will contain the token in plain text. Continue?", profile, *target)) {
+		fmt.Println("Operation cancelled")
+		return
+	}
+
+	data, err := readStoredKubeconfig(profile)
+	if err != nil {
+		fmt.Printf("Failed to read kubeconfig: %s\n", err)
+		return
+	}
+	config, err := parseKubeconfig(data)
+	if err != nil {
+		fmt.Printf("Failed to read kubeconfig: %s\n", err)
+		return
+	}
+	source, err := config.extractContext("")
+	if err != nil {
+		fmt.Printf("Failed to read kubeconfig: %s\n", err)
+		return
+	}
+
+	namespace := source.Contexts[0].Context.Namespace
+	if namespaceFlag != "" {
+		namespace = namespaceFlag
+	} else if configured := loadSettings().String("namespace"); configured != "" {
+		namespace = configured
+	}
+
+	doc, err := readKubeconfigDocument(*target)
+	if err != nil {
+		fmt.Printf("Failed to read %s: %s\n", *target, err)
+		return
+	}
+
+	context := yaml.MapSlice{{Key: "cluster", Value: *name}, {Key: "user", Value: *name}}
+	if namespace != "" {
+		context = append(context, yaml.MapItem{Key: "namespace", Value: namespace})
+	}
+	upsertNamed(&doc, "clusters", *name, "cluster", source.Clusters[0].Cluster)
+	upsertNamed(&doc, "users", *name, "user", source.Users[0].User)
+	upsertNamed(&doc, "contexts", *name, "context", context)
+	if *use {
+		setDocumentValue(&doc, "current-context", *name)
+	}
+
+	if err := writeKubeconfigDocument(*target, doc); err != nil {
+		fmt.Printf("Failed to write %s: %s\n", *target, err)
+		return
+	}
+	recordArtifact(manifestEntry{Kind: artifactKubeconfigEntry, Path: *target, Text: *name})
+
+	fmt.Printf("✅ Context %s of profile %s exported to %s\n", *name, profile, *target)
+	if *use {
+		fmt.Printf("It is now the current context, try: kubectl get pods\n")
+	} else {
+		fmt.Printf("Use it with: kubectl --context %s get pods\n", *name)
+	}
+	fmt.Println("Run the export again after 'hpcgame login' to update the token")
+}
+
+// readKubeconfigDocument reads a kubeconfig as an ordered document, so
+// fields hpcgame does not know about survive a rewrite
+func readKubeconfigDocument(path string) (yaml.MapSlice, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return yaml.MapSlice{
+			{Key: "apiVersion", Value: "v1"},
+			{Key: "kind", Value: "Config"},
+			{Key: "current-context", Value: ""},
+			{Key: "clusters", Value: []interface{}{}},
+			{Key: "contexts", Value: []interface{}{}},
+			{Key: "users", Value: []interface{}{}},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %s", err)
+	}
+	return doc, nil
+}
+
+func writeKubeconfigDocument(path string, doc yaml.MapSlice) error {
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeFileAtomic(path, data, perm)
+}
+
+func documentValue(doc yaml.MapSlice, key string) interface{} {
+	for _, item := range doc {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func setDocumentValue(doc *yaml.MapSlice, key string, value interface{}) {
+	for i := range *doc {
+		if (*doc)[i].Key == key {
+			(*doc)[i].Value = value
+			return
+		}
+	}
+	*doc = append(*doc, yaml.MapItem{Key: key, Value: value})
+}
+
+// upsertNamed replaces the entry called name in a list such as clusters, or
+// appends it
+func upsertNamed(doc *yaml.MapSlice, listKey string, name string, bodyKey string, body interface{}) {
+	entry := yaml.MapSlice{{Key: "name", Value: name}, {Key: bodyKey, Value: body}}
+	list, _ := documentValue(*doc, listKey).([]interface{})
+	for i, item := range list {
+		if fields, ok := item.(yaml.MapSlice); ok && documentValue(fields, "name") == name {
+			list[i] = entry
+			setDocumentValue(doc, listKey, list)
+			return
+		}
+	}
+	setDocumentValue(doc, listKey, append(list, entry))
+}
+
+// removeKubeconfigEntries deletes an exported context with its cluster and
+// user from a kubeconfig
+func removeKubeconfigEntries(path string, name string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	doc, err := readKubeconfigDocument(path)
+	if err != nil {
+		return err
+	}
+	for _, listKey := range []string{"clusters", "contexts", "users"} {
+		list, _ := documentValue(doc, listKey).([]interface{})
+		kept := []interface{}{}
+		for _, item := range list {
+			if fields, ok := item.(yaml.MapSlice); ok && documentValue(fields, "name") == name {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		setDocumentValue(&doc, listKey, kept)
+	}
+	if documentValue(doc, "current-context") == name {
+		setDocumentValue(&doc, "current-context", "")
+	}
+	return writeKubeconfigDocument(path, doc)
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	encryptedKubeconfigFile   = "kubeconfig.enc"
+	encryptedKubeconfigFormat = "hpcgame-encrypted-kubeconfig"
+
+	// passphraseEnv supplies the passphrase for scripts, instead of a prompt
+	passphraseEnv = "HPCGAME_KUBECONFIG_PASSPHRASE"
+)
+
+// encryptedKubeconfig is the on-disk format of kubeconfig.enc: the
+// kubeconfig sealed with XChaCha20-Poly1305 under a scrypt-derived key
+type encryptedKubeconfig struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// tempKubeconfig is the decrypted copy used by the current invocation
+var tempKubeconfig string
+
+func kubeconfigPaths(profile string) (plain string, encrypted string, err error) {
+	dir, err := profileDir(profile)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, kubeconfigFile), filepath.Join(dir, encryptedKubeconfigFile), nil
+}
+
+// kubeconfigEncrypted reports whether a profile stores its kubeconfig encrypted
+func kubeconfigEncrypted(profile string) bool {
+	_, encrypted, err := kubeconfigPaths(profile)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(encrypted)
+	return err == nil
+}
+
+// keyID identifies the key of an encrypted file in the agent cache
+func (e *encryptedKubeconfig) keyID() string {
+	return hex.EncodeToString(e.Salt)
+}
+
+func (e *encryptedKubeconfig) deriveKey(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, e.Salt, e.N, e.R, e.P, chacha20poly1305.KeySize)
+}
+
+func (e *encryptedKubeconfig) open(key []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, e.Nonce, e.Data, []byte(encryptedKubeconfigFormat))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted file")
+	}
+	return plain, nil
+}
+
+// seal encrypts data with key under a fresh nonce, keeping the salt
+func (e *encryptedKubeconfig) seal(key []byte, data []byte) error {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return err
+	}
+	e.Data = aead.Seal(nil, e.Nonce, data, []byte(encryptedKubeconfigFormat))
+	return nil
+}
+
+func newEncryptedKubeconfig() (*encryptedKubeconfig, error) {
+	e := &encryptedKubeconfig{
+		Format:  encryptedKubeconfigFormat,
+		Version: 1,
+		KDF:     "scrypt",
+		N:       1 << 15,
+		R:       8,
+		P:       1,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func readEncryptedKubeconfig(path string) (*encryptedKubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &encryptedKubeconfig{}
+	if err := json.Unmarshal(data, e); err != nil || e.Format != encryptedKubeconfigFormat {
+		return nil, fmt.Errorf("%s is not an encrypted kubeconfig", path)
+	}
+	if e.Version != 1 || e.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported encrypted kubeconfig version %d (%s), please upgrade hpcgame", e.Version, e.KDF)
+	}
+	return e, nil
+}
+
+func writeEncryptedKubeconfig(path string, e *encryptedKubeconfig) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// writeFileAtomic replaces path with data, so a failed write keeps the old file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// readPassphrase asks for a passphrase without echoing it, or takes it from
+// HPCGAME_KUBECONFIG_PASSPHRASE
+func readPassphrase(prompt string) ([]byte, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if completing {
+		return nil, fmt.Errorf("the kubeconfig is locked")
+	}
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("a passphrase is required, run in a terminal or set %s", passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// unlockKey returns the key of an encrypted kubeconfig, from the agent if it
+// is cached there and otherwise by asking for the passphrase
+func unlockKey(profile string, e *encryptedKubeconfig) ([]byte, error) {
+	if key := agentGetKey(e.keyID()); key != nil {
+		if _, err := e.open(key); err == nil {
+			debugf("Kubeconfig key of profile %s taken from the agent", profile)
+			return key, nil
+		}
+	}
+
+	attempts := 3
+	if os.Getenv(passphraseEnv) != "" {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for the kubeconfig of profile %s: ", profile))
+		if err != nil {
+			return nil, err
+		}
+		key, err := e.deriveKey(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := e.open(key); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s\n", err)
+			continue
+		}
+		agentAddKey(e.keyID(), key)
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to unlock the kubeconfig of profile %s", profile)
+}
+
+// readStoredKubeconfig returns the kubeconfig of a profile, decrypting it if
+// it is stored encrypted
+func readStoredKubeconfig(profile string) ([]byte, error) {
+	plain, encrypted, err := kubeconfigPaths(profile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(encrypted); err != nil {
+		return os.ReadFile(plain)
+	}
+
+	e, err := readEncryptedKubeconfig(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	key, err := unlockKey(profile, e)
+	if err != nil {
+		return nil, err
+	}
+	return e.open(key)
+}
+
+// writeStoredKubeconfig replaces the kubeconfig of a profile, encrypting it
+// with the existing passphrase if the profile uses encrypted storage
+func writeStoredKubeconfig(profile string, data []byte) (string, error) {
+	plain, encrypted, err := kubeconfigPaths(profile)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(plain), 0700); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(encrypted); err != nil {
+		return plain, writeFileAtomic(plain, data, 0600)
+	}
+
+	e, err := readEncryptedKubeconfig(encrypted)
+	if err != nil {
+		return "", err
+	}
+	key, err := unlockKey(profile, e)
+	if err != nil {
+		return "", err
+	}
+	if err := e.seal(key, data); err != nil {
+		return "", err
+	}
+	return encrypted, writeEncryptedKubeconfig(encrypted, e)
+}
+
+// materializeKubeconfig writes a decrypted kubeconfig to a private temporary
+// file for kubectl. It is removed when hpcgame exits.
+func materializeKubeconfig(data []byte) (string, error) {
+	if tempKubeconfig != "" {
+		return tempKubeconfig, nil
+	}
+
+	// Prefer the per-user runtime directory, which is usually a tmpfs
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	tmpFile, err := os.CreateTemp(dir, "hpcgame-kubeconfig-*")
+	if err != nil {
+		return "", err
+	}
+	tempKubeconfig = tmpFile.Name()
+
+	// Remove the file if hpcgame is interrupted
+	cleanupOnInterrupt()
+
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		cleanupKubeconfig()
+		return "", err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		cleanupKubeconfig()
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		cleanupKubeconfig()
+		return "", err
+	}
+	debugf("Decrypted kubeconfig to %s", tempKubeconfig)
+	return tempKubeconfig, nil
+}
+
+func cleanupKubeconfig() {
+	if tempKubeconfig != "" {
+		os.Remove(tempKubeconfig)
+		tempKubeconfig = ""
+	}
+}
+
+var (
+	exitHooks     []func()
+	exitHooksLock sync.Mutex
+	interruptOnce sync.Once
+)
+
+// atExit registers fn to run before hpcgame exits through exit or an
+// interrupt. Hooks run in reverse order, before the decrypted kubeconfig is
+// removed, so they can still use kubectl.
+func atExit(fn func()) {
+	exitHooksLock.Lock()
+	exitHooks = append(exitHooks, fn)
+	exitHooksLock.Unlock()
+	cleanupOnInterrupt()
+}
+
+func runExitHooks() {
+	exitHooksLock.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitHooksLock.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+// cleanupOnInterrupt runs the exit hooks and removes the decrypted
+// kubeconfig on Ctrl+C, SIGTERM or SIGHUP, which ssh sends to a ProxyCommand
+func cleanupOnInterrupt() {
+	interruptOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			<-signals
+			runExitHooks()
+			cleanupKubeconfig()
+			os.Exit(130)
+		}()
+	})
+}
+
+// exit runs the exit hooks and removes the decrypted kubeconfig before
+// exiting with code
+func exit(code int) {
+	runExitHooks()
+	cleanupKubeconfig()
+	os.Exit(code)
+}
+
+func handleKubeconfigCommands() {
+	if len(os.Args) < 3 {
+		printKubeconfigHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "encrypt":
+		encryptKubeconfig()
+	case "decrypt":
+		decryptKubeconfig()
+	case "export":
+		exportKubeconfig()
+	case "status":
+		profile := currentProfile()
+		plain, encrypted, err := kubeconfigPaths(profile)
+		if err != nil {
+			fmt.Printf("Failed to get user home directory: %s\n", err)
+			return
+		}
+		switch {
+		case kubeconfigEncrypted(profile):
+			fmt.Printf("Profile %s: encrypted (%s)\n", profile, encrypted)
+			if e, err := readEncryptedKubeconfig(encrypted); err == nil && agentGetKey(e.keyID()) != nil {
+				fmt.Println("Unlocked in the agent")
+			} else {
+				fmt.Println("Locked, the passphrase will be asked on next use")
+			}
+		case fileExists(plain):
+			fmt.Printf("Profile %s: plain text (%s)\n", profile, plain)
+		default:
+			fmt.Printf("Profile %s: no kubeconfig, run 'hpcgame install'\n", profile)
+		}
+	default:
+		fmt.Printf("Unknown kubeconfig subcommand: %s\n", os.Args[2])
+		printKubeconfigHelp()
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// encryptKubeconfig moves a profile's kubeconfig to encrypted storage
+func encryptKubeconfig() {
+	profile := currentProfile()
+	plain, encrypted, err := kubeconfigPaths(profile)
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+	if kubeconfigEncrypted(profile) {
+		fmt.Printf("The kubeconfig of profile %s is already encrypted\n", profile)
+		return
+	}
+	data, err := os.ReadFile(plain)
+	if err != nil {
+		fmt.Printf("Failed to read kubeconfig: %s\n", err)
+		return
+	}
+
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		return
+	}
+	if len(passphrase) == 0 {
+		fmt.Println("❌ The passphrase must not be empty")
+		return
+	}
+	if os.Getenv(passphraseEnv) == "" {
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			return
+		}
+		if string(again) != string(passphrase) {
+			fmt.Println("❌ Passphrases do not match")
+			return
+		}
+	}
+
+	e, err := newEncryptedKubeconfig()
+	if err != nil {
+		fmt.Printf("Failed to encrypt kubeconfig: %s\n", err)
+		return
+	}
+	key, err := e.deriveKey(passphrase)
+	if err == nil {
+		err = e.seal(key, data)
+	}
+	if err == nil {
+		err = writeEncryptedKubeconfig(encrypted, e)
+	}
+	if err != nil {
+		fmt.Printf("Failed to encrypt kubeconfig: %s\n", err)
+		return
+	}
+	recordArtifact(manifestEntry{Kind: artifactFile, Path: encrypted})
+
+	if err := os.Remove(plain); err != nil {
+		fmt.Printf("⚠️ Failed to remove the plain text kubeconfig %s: %s\n", plain, err)
+	}
+	agentAddKey(e.keyID(), key)
+
+	fmt.Printf("✅ Kubeconfig of profile %s encrypted to %s\n", profile, encrypted)
+	fmt.Println("Copies made before (backups, ~/.kube/config) are not affected")
+}
+
+// decryptKubeconfig moves a profile's kubeconfig back to plain text storage
+func decryptKubeconfig() {
+	profile := currentProfile()
+	plain, encrypted, err := kubeconfigPaths(profile)
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+	if !kubeconfigEncrypted(profile) {
+		fmt.Printf("The kubeconfig of profile %s is not encrypted\n", profile)
+		return
+	}
+
+	data, err := readStoredKubeconfig(profile)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		return
+	}
+	if err := writeFileAtomic(plain, data, 0600); err != nil {
+		fmt.Printf("Failed to save kubeconfig: %s\n", err)
+		return
+	}
+	if err := os.Remove(encrypted); err != nil {
+		fmt.Printf("Failed to remove %s: %s\n", encrypted, err)
+		return
+	}
+
+	fmt.Printf("✅ Kubeconfig of profile %s stored as plain text in %s\n", profile, plain)
+}
+
+func printKubeconfigHelp() {
+	helpText := `Kubeconfig command usage:
+  hpcgame kubeconfig status    Show how the kubeconfig of the active profile is stored
+  hpcgame kubeconfig encrypt   Encrypt the kubeconfig with a passphrase
+  hpcgame kubeconfig decrypt   Store the kubeconfig as plain text again
+  hpcgame kubeconfig export    Merge the hpcgame context into ~/.kube/config
+                               (--use to make it current, --name, --kubeconfig PATH)
+
+Note:
+  - Encrypted kubeconfigs are decrypted to a private temporary file for each command
+  - The agent caches the key for agent_ttl (default 30m), see 'hpcgame agent'
+  - Set HPCGAME_KUBECONFIG_PASSPHRASE to supply the passphrase in scripts
+`
+	fmt.Println(helpText)
+}
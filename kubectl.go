@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	// namespaceFlag is set by the global -n/--namespace option
+	namespaceFlag string
+	// verboseFlag is set by the global --verbose option
+	verboseFlag bool
+
+	resolvedNamespace       string
+	resolvedNamespaceSource string
+)
+
+// verbose reports whether diagnostic output was requested with --verbose or DEBUG
+func verbose() bool {
+	return verboseFlag || os.Getenv("DEBUG") != ""
+}
+
+func debugf(format string, args ...interface{}) {
+	if verbose() {
+		fmt.Fprintf(os.Stderr, "[debug] "+format+"\n", args...)
+	}
+}
+
+// resolveNamespace returns the namespace every kubectl call runs in. In order
+// of precedence: -n/--namespace, the namespace setting (HPCGAME_NAMESPACE,
+// profile, user or project config), the kubeconfig context, then "default".
+func resolveNamespace(kubeconfigPath string) string {
+	if resolvedNamespace != "" {
+		return resolvedNamespace
+	}
+
+	namespace, source := namespaceFlag, "--namespace flag"
+	if namespace == "" {
+		settings := loadSettings()
+		namespace, source = settings.String("namespace"), settings.sources["namespace"]
+	}
+	if namespace == "" {
+		cmd := exec.Command(kubectlBinary(), "--kubeconfig", kubeconfigPath, "config", "view", "--minify", "-o", "jsonpath={..namespace}")
+		output, err := cmd.Output()
+		if err == nil {
+			namespace, source = strings.TrimSpace(string(output)), "kubeconfig context"
+		}
+	}
+	if namespace == "" {
+		namespace, source = "default", "fallback"
+	}
+
+	debugf("Using namespace %s (from %s)", namespace, source)
+	resolvedNamespace, resolvedNamespaceSource = namespace, source
+	return namespace
+}
+
+// kubectlBinary returns the kubectl executable to run, preferring the managed
+// kubectl selected with 'hpcgame kubectl use' over the one on PATH
+func kubectlBinary() string {
+	if path := managedKubectlPath(currentManagedKubectl()); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return "kubectl"
+}
+
+// kubectlCommand builds a kubectl command bound to the given kubeconfig and
+// the resolved namespace
+func kubectlCommand(kubeconfigPath string, args ...string) *exec.Cmd {
+	namespace := resolveNamespace(kubeconfigPath)
+	kubectlArgs := append([]string{"--kubeconfig", kubeconfigPath, "--namespace", namespace}, args...)
+	debugf("Running: kubectl %s", strings.Join(kubectlArgs, " "))
+	cmd := exec.Command(kubectlBinary(), kubectlArgs...)
+	cmd.Stderr = watchCredentials(nil)
+	return cmd
+}
+
+func checkKubectlInstalled() bool {
+	_, err := exec.LookPath(kubectlBinary())
+	return err == nil
+}
+
+// kubectlDownloadURL returns the release URL of kubectl for this platform
+func kubectlDownloadURL(mirror string, version string) string {
+	binary := "kubectl"
+	if runtime.GOOS == "windows" {
+		binary = "kubectl.exe"
+	}
+	return fmt.Sprintf("%s/%s/bin/%s/%s/%s", strings.TrimSuffix(mirror, "/"), version, runtime.GOOS, runtime.GOARCH, binary)
+}
+
+func installKubectl(opts installOptions) bool {
+	fmt.Println("Installing kubectl...")
+
+	settings := loadSettings()
+	version := settings.String("kubectl_version")
+	mirror := settings.String("kubectl_mirror")
+
+	// Let the platform package manager handle kubectl unless a location or file was given
+	if opts.KubectlDir == "" && opts.KubectlFile == "" {
+		var cmd *exec.Cmd
+		switch {
+		case runtime.GOOS == "darwin" && checkCommandExists("brew"):
+			cmd = exec.Command("brew", "install", "kubectl")
+		case runtime.GOOS == "windows" && checkCommandExists("winget"):
+			cmd = exec.Command("winget", "install", "--id", "Kubernetes.kubectl", "-e")
+		}
+		if cmd != nil {
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				fmt.Printf("Failed to install kubectl: %s\n%s\n", err, string(output))
+				return false
+			}
+			fmt.Println("✅ kubectl installed successfully")
+			return true
+		}
+	}
+
+	installPath := chooseKubectlDir(opts)
+	if installPath == "" {
+		return false
+	}
+
+	// Stage a verified binary
+	staged := opts.KubectlFile
+	if staged != "" {
+		expected := opts.KubectlSHA256
+		if expected == "" {
+			if data, err := os.ReadFile(staged + ".sha256"); err == nil {
+				expected = string(data)
+			}
+		}
+		if expected == "" && !opts.SkipVerify {
+			fmt.Printf("❌ No checksum given for %s: use --kubectl-sha256, place %s.sha256 next to it,\n", staged, filepath.Base(staged))
+			fmt.Println("   or pass --insecure-skip-verify to install it unverified")
+			return false
+		} else if expected == "" {
+			fmt.Printf("⚠️ Installing %s without verifying its checksum (--insecure-skip-verify)\n", staged)
+		} else if err := verifySHA256(staged, expected); err != nil {
+			fmt.Printf("❌ %s\n", err)
+			return false
+		} else {
+			fmt.Println("✅ kubectl checksum verified")
+		}
+	} else {
+		url := kubectlDownloadURL(mirror, version)
+		path, err := downloadVerified(url, url+".sha256")
+		if err != nil {
+			fmt.Printf("Failed to download kubectl: %s\n", err)
+			return false
+		}
+		defer os.Remove(path)
+		staged = path
+	}
+
+	binary := "kubectl"
+	if runtime.GOOS == "windows" {
+		binary = "kubectl.exe"
+	}
+	dest := filepath.Join(installPath, binary)
+	usedSudo, err := placeExecutable(staged, dest)
+	if err != nil {
+		fmt.Printf("Failed to install kubectl: %s\n", err)
+		return false
+	}
+	recordArtifact(manifestEntry{Kind: artifactFile, Path: dest, Sudo: usedSudo})
+	fmt.Printf("✅ kubectl installed to %s\n", dest)
+
+	if !dirInPath(installPath) {
+		// Modify PATH for current session
+		os.Setenv("PATH", os.Getenv("PATH")+string(os.PathListSeparator)+installPath)
+		addToShellPath(installPath, opts)
+	}
+
+	return true
+}
+
+// chooseKubectlDir returns where kubectl should be installed, asking the user
+// unless running non-interactively
+func chooseKubectlDir(opts installOptions) string {
+	if opts.KubectlDir != "" {
+		return opts.KubectlDir
+	}
+
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return ""
+	}
+	userDir := filepath.Join(hpcgameDir, "bin")
+
+	if runtime.GOOS == "windows" {
+		return userDir
+	}
+	// Without write access /usr/local/bin needs sudo, which may ask for a password
+	systemDir := "/usr/local/bin"
+	systemWritable := dirWritable(systemDir)
+	if opts.Yes {
+		if systemWritable {
+			return systemDir
+		}
+		return userDir
+	}
+
+	fmt.Println("Where would you like to install kubectl?")
+	if systemWritable {
+		fmt.Println("1. /usr/local/bin [Default]")
+		fmt.Println("2. ~/.hpcgame/bin (no sudo required)")
+	} else {
+		fmt.Println("1. /usr/local/bin (requires sudo)")
+		fmt.Println("2. ~/.hpcgame/bin (no sudo required) [Default]")
+	}
+	fmt.Print("Choose option (1/2): ")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	switch strings.TrimSpace(scanner.Text()) {
+	case "1":
+		return systemDir
+	case "2":
+		return userDir
+	}
+	if systemWritable {
+		return systemDir
+	}
+	return userDir
+}
+
+// dirWritable reports whether files can be created in dir
+func dirWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".hpcgame-write-test-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// downloadVerified downloads url into a temporary file and checks it against
+// the SHA-256 published at checksumURL. The caller removes the file.
+func downloadVerified(url string, checksumURL string) (string, error) {
+	fmt.Printf("Downloading %s\n", url)
+
+	resp, err := http.Get(checksumURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get checksum: %s", err)
+	}
+	checksum, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to get checksum: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get checksum: %s", resp.Status)
+	}
+
+	resp, err = http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	tmpFile, err := os.CreateTemp("", "hpcgame-download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %s", err)
+	}
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), resp.Body); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	if err := compareSHA256(hex.EncodeToString(hash.Sum(nil)), string(checksum)); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	fmt.Println("✅ Checksum verified")
+
+	return tmpFile.Name(), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func verifySHA256(path string, expected string) error {
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum: %s", err)
+	}
+	return compareSHA256(actual, expected)
+}
+
+// compareSHA256 checks a digest against the first field of a .sha256 file
+func compareSHA256(actual string, expected string) error {
+	fields := strings.Fields(expected)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty checksum")
+	}
+	if !strings.EqualFold(fields[0], actual) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", fields[0], actual)
+	}
+	return nil
+}
+
+// placeExecutable copies src to dest with mode 0755, replacing dest
+// atomically. sudo is only used when dest's directory is not writable, in
+// which case usedSudo is true.
+func placeExecutable(src string, dest string) (usedSudo bool, err error) {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0755); err != nil && !os.IsPermission(err) {
+		return false, err
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".kubectl-*")
+	if err != nil {
+		if !os.IsPermission(err) || runtime.GOOS == "windows" {
+			return false, err
+		}
+		fmt.Printf("%s is not writable, using sudo\n", dir)
+		sudoArgs := []string{"install", "-m", "0755", src, dest}
+		if assumeYes {
+			sudoArgs = append([]string{"-n"}, sudoArgs...)
+		}
+		cmd := exec.Command("sudo", sudoArgs...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return true, cmd.Run()
+	}
+	defer os.Remove(tmpFile.Name())
+
+	in, err := os.Open(src)
+	if err != nil {
+		tmpFile.Close()
+		return false, err
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(tmpFile, in); err != nil {
+		tmpFile.Close()
+		return false, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
+		return false, err
+	}
+	return false, os.Rename(tmpFile.Name(), dest)
+}
+
+func dirInPath(dir string) bool {
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(entry) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	managedKubectlDir  = "kubectl"
+	managedCurrentFile = "current"
+)
+
+// managedKubectlRoot is where private kubectl versions are kept, one
+// directory per version, e.g. ~/.hpcgame/kubectl/v1.32.3/kubectl
+func managedKubectlRoot() (string, error) {
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hpcgameDir, managedKubectlDir), nil
+}
+
+// kubectlVersionPattern keeps version arguments from naming other directories
+var kubectlVersionPattern = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+$`)
+
+// kubectlVersionArg accepts a version argument with or without the leading v
+func kubectlVersionArg(version string) (string, error) {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !kubectlVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid kubectl version %q, expected e.g. v1.32.3", strings.TrimPrefix(version, "v"))
+	}
+	return version, nil
+}
+
+func managedKubectlPath(version string) string {
+	if !kubectlVersionPattern.MatchString(version) {
+		return ""
+	}
+	root, err := managedKubectlRoot()
+	if err != nil {
+		return ""
+	}
+	binary := "kubectl"
+	if runtime.GOOS == "windows" {
+		binary = "kubectl.exe"
+	}
+	return filepath.Join(root, version, binary)
+}
+
+// currentManagedKubectl returns the selected managed version, or "" to use kubectl from PATH
+func currentManagedKubectl() string {
+	root, err := managedKubectlRoot()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(root, managedCurrentFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func setManagedKubectl(version string) error {
+	root, err := managedKubectlRoot()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, managedCurrentFile)
+	if version == "" {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(version+"\n"), 0600)
+}
+
+func listManagedKubectl() []string {
+	root, err := managedKubectlRoot()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if _, err := os.Stat(managedKubectlPath(entry.Name())); err == nil {
+				versions = append(versions, entry.Name())
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions
+}
+
+// installManagedKubectl downloads and verifies a kubectl version into ~/.hpcgame/kubectl
+func installManagedKubectl(version string) error {
+	version, err := kubectlVersionArg(version)
+	if err != nil {
+		return err
+	}
+	url := kubectlDownloadURL(loadSettings().String("kubectl_mirror"), version)
+	path, err := downloadVerified(url, url+".sha256")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	dest := managedKubectlPath(version)
+	if dest == "" {
+		return fmt.Errorf("failed to get user home directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	if _, err := placeExecutable(path, dest); err != nil {
+		return err
+	}
+	recordArtifact(manifestEntry{Kind: artifactDir, Path: filepath.Dir(dest)})
+	fmt.Printf("✅ kubectl %s installed to %s\n", version, dest)
+	return nil
+}
+
+type kubectlVersions struct {
+	Client string
+	Server string
+}
+
+// getKubectlVersions asks kubectl for its own and the cluster's version. The
+// client version is returned even if the server is unreachable.
+func getKubectlVersions(kubeconfigPath string) (kubectlVersions, error) {
+	args := []string{"version", "-o", "json"}
+	if kubeconfigPath != "" {
+		args = append([]string{"--kubeconfig", kubeconfigPath}, args...)
+	}
+	cmd := exec.Command(kubectlBinary(), args...)
+	output, runErr := cmd.Output()
+
+	var parsed struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+		ServerVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		if runErr != nil {
+			return kubectlVersions{}, runErr
+		}
+		return kubectlVersions{}, fmt.Errorf("failed to parse kubectl version: %s", err)
+	}
+
+	versions := kubectlVersions{
+		Client: parsed.ClientVersion.GitVersion,
+		Server: parsed.ServerVersion.GitVersion,
+	}
+	if versions.Server == "" && runErr != nil {
+		return versions, fmt.Errorf("failed to get server version: %s", runErr)
+	}
+	return versions, nil
+}
+
+// parseVersion extracts major, minor and patch from strings like v1.30.4+k3s1
+func parseVersion(version string) (int, int, int, bool) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "+-"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, 0, false
+	}
+	numbers := make([]int, 3)
+	for i := 0; i < len(parts) && i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		numbers[i] = n
+	}
+	return numbers[0], numbers[1], numbers[2], true
+}
+
+func compareVersions(a string, b string) int {
+	aMajor, aMinor, aPatch, _ := parseVersion(a)
+	bMajor, bMinor, bPatch, _ := parseVersion(b)
+	switch {
+	case aMajor != bMajor:
+		return aMajor - bMajor
+	case aMinor != bMinor:
+		return aMinor - bMinor
+	default:
+		return aPatch - bPatch
+	}
+}
+
+// releaseVersion strips distribution suffixes, e.g. v1.30.4+k3s1 -> v1.30.4
+func releaseVersion(version string) string {
+	major, minor, patch, ok := parseVersion(version)
+	if !ok {
+		return version
+	}
+	return fmt.Sprintf("v%d.%d.%d", major, minor, patch)
+}
+
+// kubectlSkewSupported reports whether client and server are within the
+// one-minor-version skew kubectl supports
+func kubectlSkewSupported(client string, server string) bool {
+	cMajor, cMinor, _, ok1 := parseVersion(client)
+	sMajor, sMinor, _, ok2 := parseVersion(server)
+	if !ok1 || !ok2 {
+		return true
+	}
+	if cMajor != sMajor {
+		return false
+	}
+	skew := cMinor - sMinor
+	return skew >= -1 && skew <= 1
+}
+
+// checkKubectlCompatibility compares kubectl with the cluster and, if they are
+// too far apart, offers to install a matching private kubectl. It returns false
+// if the versions are incompatible and nothing was changed.
+func checkKubectlCompatibility(kubeconfigPath string, offerInstall bool) bool {
+	versions, err := getKubectlVersions(kubeconfigPath)
+	if err != nil {
+		fmt.Printf("⚠️ Could not compare kubectl and cluster versions: %s\n", err)
+		return true
+	}
+
+	if kubectlSkewSupported(versions.Client, versions.Server) {
+		fmt.Printf("✅ kubectl %s is compatible with cluster %s\n", versions.Client, versions.Server)
+		return true
+	}
+
+	target := releaseVersion(versions.Server)
+	fmt.Printf("⚠️ kubectl %s is too far from cluster version %s (at most one minor version apart is supported)\n", versions.Client, versions.Server)
+	if !offerInstall {
+		fmt.Printf("Run 'hpcgame kubectl install %s' to install a matching kubectl\n", target)
+		return false
+	}
+
+	if !askConfirm(fmt.Sprintf("Install kubectl %s into ~/.hpcgame/kubectl for use by hpcgame?", target)) {
+		return false
+	}
+	if err := installManagedKubectl(target); err != nil {
+		fmt.Printf("Failed to install kubectl: %s\n", err)
+		return false
+	}
+	if err := setManagedKubectl(target); err != nil {
+		fmt.Printf("Failed to select kubectl %s: %s\n", target, err)
+		return false
+	}
+	fmt.Printf("✅ hpcgame now uses kubectl %s (your PATH is unchanged)\n", target)
+	return true
+}
+
+func handleKubectlCommands() {
+	if len(os.Args) < 3 {
+		printKubectlHelp()
+		return
+	}
+
+	subCommand := os.Args[2]
+
+	switch subCommand {
+	case "ls", "list":
+		current := currentManagedKubectl()
+		marker := " "
+		if current == "" {
+			marker = "*"
+		}
+		systemPath, err := exec.LookPath("kubectl")
+		if err != nil {
+			systemPath = "not found"
+		}
+		fmt.Printf("%s %-12s %s\n", marker, "system", systemPath)
+		for _, version := range listManagedKubectl() {
+			marker = " "
+			if version == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %-12s %s\n", marker, version, managedKubectlPath(version))
+		}
+	case "install":
+		version := loadSettings().String("kubectl_version")
+		if len(os.Args) > 3 {
+			version = os.Args[3]
+		}
+		if err := installManagedKubectl(version); err != nil {
+			fmt.Printf("Failed to install kubectl: %s\n", err)
+			return
+		}
+		if currentManagedKubectl() == "" {
+			fmt.Printf("Run 'hpcgame kubectl use %s' to use it\n", version)
+		}
+	case "use":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame kubectl use VERSION|system")
+			return
+		}
+		version := os.Args[3]
+		if version == "system" {
+			version = ""
+		} else {
+			var err error
+			if version, err = kubectlVersionArg(version); err != nil {
+				fmt.Printf("❌ %s\n", err)
+				return
+			}
+			if _, err := os.Stat(managedKubectlPath(version)); err != nil {
+				fmt.Printf("kubectl %s is not installed. Run 'hpcgame kubectl install %s' first\n", version, version)
+				return
+			}
+		}
+		if err := setManagedKubectl(version); err != nil {
+			fmt.Printf("Failed to select kubectl: %s\n", err)
+			return
+		}
+		fmt.Printf("✅ hpcgame now uses %s\n", kubectlBinary())
+	case "rm", "remove", "delete":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame kubectl rm VERSION")
+			return
+		}
+		version, err := kubectlVersionArg(os.Args[3])
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			return
+		}
+		path := managedKubectlPath(version)
+		if _, err := os.Stat(path); err != nil {
+			fmt.Printf("kubectl %s is not installed\n", version)
+			return
+		}
+		if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+			fmt.Printf("Failed to remove kubectl %s: %s\n", version, err)
+			return
+		}
+		if currentManagedKubectl() == version {
+			setManagedKubectl("")
+			fmt.Println("Switched back to the system kubectl")
+		}
+		fmt.Printf("✅ kubectl %s removed\n", version)
+	case "check":
+		kubeconfigPath := getKubeConfig()
+		if kubeconfigPath == "" {
+			return
+		}
+		checkKubectlCompatibility(kubeconfigPath, true)
+	default:
+		fmt.Printf("Unknown kubectl subcommand: %s\n", subCommand)
+		printKubectlHelp()
+	}
+}
+
+func printKubectlHelp() {
+	helpText := `Kubectl command usage:
+  hpcgame kubectl ls                    List kubectl versions (* marks the one hpcgame uses)
+  hpcgame kubectl install [VERSION]     Install a private kubectl into ~/.hpcgame/kubectl
+  hpcgame kubectl use VERSION|system    Choose the kubectl hpcgame runs
+  hpcgame kubectl rm VERSION            Remove a private kubectl
+  hpcgame kubectl check                 Compare kubectl with the cluster version
+
+Note:
+  - Private kubectl versions are only used by hpcgame; PATH and shell rc files are not changed
+  - kubectl supports clusters at most one minor version older or newer
+`
+	fmt.Println(helpText)
+}
@@ -11,7 +11,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -20,9 +19,12 @@ import (
 const (
 	kubeconfigDir  = ".hpcgame"
 	kubeconfigFile = "kubeconfig"
-	version        = "0.4.0"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."; builds
+// without it are development builds, which are never updated automatically
+var version = "dev"
+
 type Container struct {
 	Name   string
 	CPU    int
@@ -50,6 +52,8 @@ type PersistentVolume struct {
 }
 
 func main() {
+	parseGlobalFlags()
+
 	if len(os.Args) < 2 {
 		printHelp()
 		return
@@ -72,7 +76,13 @@ func main() {
 	case "ls":
 		listContainers()
 	case "lspart":
-		listPartitions(getPartitions())
+		partitions := getPartitions()
+		if outputJSON() {
+			printJSON(partitions)
+		} else {
+			printProfileHeader()
+			listPartitions(partitions)
+		}
 	case "delete":
 		deleteContainer()
 	// Docker-like commands
@@ -86,35 +96,176 @@ func main() {
 		execInContainer()
 	case "cp":
 		copyFiles()
+	case "sync":
+		syncFiles()
 	case "port", "ports", "portforward":
 		portForward()
+	case "proxy":
+		runProxy()
+	case "ssh-config":
+		sshConfig()
+	case "ssh-proxy":
+		sshProxy()
 	case "pull":
 		fmt.Println("Images are pre-pulled in the HPCGame environment")
 	case "rm", "kill", "stop":
 		deleteContainer()
 	case "volume", "volumes":
 		handleVolumeCommands()
+	case "config":
+		handleConfigCommands()
+	case "task", "tasks":
+		handleTaskCommands()
+	case "profile", "profiles":
+		handleProfileCommands()
+	case "kubectl":
+		handleKubectlCommands()
+	case "doctor":
+		doctor()
+	case "uninstall":
+		uninstall()
+	case "shell-init":
+		shellInit()
+	case "login":
+		login()
+	case "kubeconfig":
+		handleKubeconfigCommands()
+	case "agent":
+		handleAgentCommands()
+	case "completion":
+		completion()
+	case "update":
+		update()
+	case completeCommand:
+		completeWords(os.Args[2:])
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printHelp()
 	}
+
+	reportCredentialProblems()
+	notifyUpdate(command)
+	runExitHooks()
+	cleanupKubeconfig()
+}
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseFlags parses the options of a command. A bad option exits through
+// exit(), not os.Exit, so that a decrypted kubeconfig is removed as well.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		exit(exitOK)
+	} else if err != nil {
+		exit(exitUsage)
+	}
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// the positional arguments, and returns the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		parseFlags(flags, args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseGlobalFlags removes options that apply to every command from os.Args.
+// Short forms are only recognized before the command, since -n means --name
+// for create/run. Nothing is removed from the command run by exec.
+func parseGlobalFlags() {
+	// Completion gets the raw words, including a partly typed last one
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		return
+	}
+
+	args := []string{os.Args[0]}
+	command := ""
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		beforeCommand := command == ""
+		switch {
+		case arg == "--":
+			args = append(args, os.Args[i:]...)
+			os.Args = args
+			return
+		case arg == "--profile" && i+1 < len(os.Args):
+			profileFlag = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--profile="):
+			profileFlag = strings.TrimPrefix(arg, "--profile=")
+		case (arg == "--namespace" || (beforeCommand && arg == "-n")) && i+1 < len(os.Args):
+			namespaceFlag = os.Args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--namespace="):
+			namespaceFlag = strings.TrimPrefix(arg, "--namespace=")
+		case arg == "--verbose":
+			verboseFlag = true
+		default:
+			args = append(args, arg)
+			if beforeCommand {
+				command = arg
+			} else if command == "exec" && !strings.HasPrefix(arg, "-") {
+				// The rest is the command to run inside the container
+				args = append(args, os.Args[i+1:]...)
+				os.Args = args
+				return
+			}
+		}
+	}
+	os.Args = args
 }
 
 func printHelp() {
 	helpText := `HPCGame CLI Tool with Docker-compatible commands
 
 Usage:
-  hpcgame <command> [options]
+  hpcgame [--profile NAME] [-n NAMESPACE] [--verbose] <command> [options]
+
+Global Options:
+  --profile NAME          Use the given profile
+  -n, --namespace NAME    Kubernetes namespace (-n only before the command)
+  --verbose               Print the namespace and kubectl commands being run
 
 Original Commands:
-  install         Install and configure required components
+  install         Install and configure required components (see 'hpcgame install -h')
+  uninstall       Undo what install changed (--dry-run to preview, --remote to delete containers/volumes)
+  shell-init      Print shell setup (PATH, KUBECONFIG, completion) for bash, zsh or fish
+  completion      Print the completion script for bash, zsh or fish
+  login           Replace expired credentials in the saved kubeconfig
+  kubeconfig      Encrypt, decrypt or export the saved kubeconfig
+  agent           Manage the agent caching kubeconfig passphrases
+  update          Update hpcgame to the latest release (--check to only check)
   create          Create a new container
   ls              List containers for current account
   lspart          List available partitions
   shell           Connect to container terminal
   delete          Delete a container
   portforward     Set up port forwarding
+  proxy           Reach containers and services by name through a SOCKS5/HTTP proxy
+  ssh-config      Print ssh_config entries so that ssh, scp, rsync and VS Code reach containers
   volume          Manage persistent volumes
+  config          Show or change default settings
+  task            Run a task defined in the project's .hpcgame.yaml
+  profile         Manage accounts/clusters as named profiles
+  kubectl         Manage the kubectl versions used by hpcgame
+  doctor          Diagnose the installation and cluster access (--json for a report)
 
 Docker-compatible Commands:
   run             Create and run a new container (alternative to create)
@@ -122,8 +273,9 @@ Docker-compatible Commands:
   images          List available images for each partition
   exec            Execute a command in a running container
   cp              Copy files between local and container
+  sync            Transfer only changed files between a local directory and a container
   rm              Remove a container (same as delete)
-  port            Forward port (same as portforward)
+  port            Forward ports, also in the background (see 'hpcgame port -h')
 
 Options for create/run command:
   -p, --partition STRING  Specify partition name
@@ -133,6 +285,7 @@ Options for create/run command:
   -v, --volume LIST       Mount volumes (comma-separated)
   -i, --image STRING      Specify container image
   -n, --name STRING       Assign a name to the container
+  (defaults can be saved with 'hpcgame config set', see 'hpcgame config')
   
 Examples:
   # Create a container with 4 CPUs and 8GiB RAM in the x86 partition
@@ -153,172 +306,206 @@ Examples:
   
   # Port forwarding
   hpcgame portforward my-container 8080:80
-  # or Docker-style alternative
-  hpcgame port my-container 8080:80
+  # or Docker-style alternative, with several ports (see 'hpcgame port -h')
+  hpcgame port my-container -p 8888:8888 -p 6006:6006
+
+  # Open http://my-container:8888 through a SOCKS5 proxy (see 'hpcgame proxy -h')
+  hpcgame proxy --socks 1080
+
+  # Connect with ssh or VS Code Remote-SSH (see 'hpcgame ssh-config -h')
+  hpcgame ssh-config --write
+  ssh my-container
 
 Volume Commands:
   hpcgame volume ls                                     List all volumes
   hpcgame volume create NAME SIZE STORAGE_CLASS [MODE]  Create a new volume
   hpcgame volume rm NAME                                Delete a volume
 
+Config Commands:
+  hpcgame config list                                   Show effective settings
+  hpcgame config set KEY VALUE                          Save a default setting
+  hpcgame config explain                                Show where each setting comes from
+  hpcgame task run NAME [CONTAINER]                     Run a project task
+
+Profile Commands:
+  hpcgame profile ls                                    List profiles
+  hpcgame profile add NAME [KUBECONFIG_FILE]            Add a profile
+  hpcgame profile use NAME                              Switch profile
+
 Note:
   - Default partition volume is automatically mounted to /partition-data
   - Additional volumes are mounted to /mnt/VOLUME_NAME
+  - Settings are read from .hpcgame.yaml (project), ~/.hpcgame/config.yaml and
+    HPCGAME_* environment variables, later ones taking precedence
 `
 	fmt.Println(helpText)
 }
 
+// Exit codes of 'hpcgame install', so provisioning scripts can tell failures apart
+const (
+	exitOK                = 0
+	exitFailure           = 1
+	exitUsage             = 2
+	exitKubectlFailed     = 3
+	exitInvalidKubeconfig = 4
+	exitKubeconfigExists  = 5
+	exitPartitionsFailed  = 6
+)
+
+type installOptions struct {
+	KubeconfigFile string
+	KubeconfigEnv  string
+	From           string
+	Context        string
+	KubectlDir     string
+	KubectlFile    string
+	KubectlSHA256  string
+	SkipVerify     bool
+	NoVSCode       bool
+	NoModifyRC     bool
+	Force          bool
+	Yes            bool
+}
+
 func install() {
+	installCmd := flag.NewFlagSet("install", flag.ContinueOnError)
+
+	opts := installOptions{}
+	installCmd.StringVar(&opts.KubeconfigFile, "kubeconfig-file", "", "Read kubeconfig from file instead of stdin ('-' for stdin)")
+	installCmd.StringVar(&opts.KubeconfigEnv, "kubeconfig-env", "", "Read kubeconfig from the named environment variable")
+	installCmd.StringVar(&opts.From, "from", "", "Import a context from an existing kubeconfig, e.g. ~/.kube/config")
+	installCmd.StringVar(&opts.Context, "context", "", "Context to import (default: the current context of the kubeconfig)")
+	installCmd.StringVar(&opts.KubectlDir, "kubectl-dir", "", "Directory to install kubectl into")
+	installCmd.StringVar(&opts.KubectlFile, "kubectl-file", "", "Install kubectl from a pre-downloaded binary instead of downloading it")
+	installCmd.StringVar(&opts.KubectlSHA256, "kubectl-sha256", "", "Expected SHA-256 of --kubectl-file (default: read PATH.sha256 if present)")
+	installCmd.BoolVar(&opts.SkipVerify, "insecure-skip-verify", false, "Install --kubectl-file without a checksum")
+	installCmd.BoolVar(&opts.NoVSCode, "no-vscode", false, "Skip installing VSCode extensions")
+	installCmd.BoolVar(&opts.NoModifyRC, "no-modify-rc", false, "Do not add the kubectl directory to shell rc files (see 'hpcgame shell-init')")
+	installCmd.BoolVar(&opts.Force, "force", false, "Overwrite an existing kubeconfig without asking")
+	installCmd.BoolVar(&opts.Yes, "yes", false, "Run non-interactively, accepting default answers")
+	installCmd.BoolVar(&opts.Yes, "y", false, "Run non-interactively (short)")
+
+	installCmd.Usage = func() {
+		fmt.Println("Usage: hpcgame install [OPTIONS]")
+		fmt.Println("Options:")
+		installCmd.PrintDefaults()
+		fmt.Println("\nExit codes:")
+		fmt.Println("  0 success, 1 failure, 2 usage error, 3 kubectl installation failed,")
+		fmt.Println("  4 invalid kubeconfig, 5 kubeconfig exists (use --force), 6 partition information unavailable")
+	}
+	parseFlags(installCmd, os.Args[2:])
+
+	sources := 0
+	for _, source := range []string{opts.KubeconfigFile, opts.KubeconfigEnv, opts.From} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Println("❌ --kubeconfig-file, --kubeconfig-env and --from cannot be used together")
+		exit(exitUsage)
+	}
+
+	if code := runInstall(opts); code != exitOK {
+		exit(code)
+	}
+}
+
+func runInstall(opts installOptions) int {
+	assumeYes = opts.Yes
+
+	// Record the HPCGame directory so uninstall can remove it
+	if hpcgameDir, err := hpcgameHome(); err == nil {
+		if _, err := os.Stat(hpcgameDir); os.IsNotExist(err) {
+			if err := os.MkdirAll(hpcgameDir, 0700); err != nil {
+				fmt.Printf("Failed to create directory: %s\n", err)
+				return exitFailure
+			}
+			recordArtifact(manifestEntry{Kind: artifactDir, Path: hpcgameDir})
+		}
+	}
+
 	// 1. Check if kubectl is installed
-	if !checkKubectlInstalled() {
-		installKubectl()
+	if !checkKubectlInstalled() || opts.KubectlFile != "" {
+		if !installKubectl(opts) {
+			return exitKubectlFailed
+		}
 	} else {
 		fmt.Println("✅ kubectl is already installed")
 	}
 
-	// 2. Get kubeconfig from user and validate
-	kubeconfig := getKubeconfigFromUser()
+	// 2. Get kubeconfig and validate
+	var kubeconfig string
+	switch {
+	case opts.KubeconfigEnv != "":
+		kubeconfig = os.Getenv(opts.KubeconfigEnv)
+		if kubeconfig == "" {
+			fmt.Printf("❌ Environment variable %s is empty or not set\n", opts.KubeconfigEnv)
+			return exitInvalidKubeconfig
+		}
+	case opts.KubeconfigFile != "" && opts.KubeconfigFile != "-":
+		data, err := os.ReadFile(opts.KubeconfigFile)
+		if err != nil {
+			fmt.Printf("❌ Failed to read kubeconfig: %s\n", err)
+			return exitInvalidKubeconfig
+		}
+		kubeconfig = string(data)
+	case opts.From != "":
+		data, err := os.ReadFile(expandHome(opts.From))
+		if err != nil {
+			fmt.Printf("❌ Failed to read kubeconfig: %s\n", err)
+			return exitInvalidKubeconfig
+		}
+		kubeconfig = string(data)
+	default:
+		kubeconfig = getKubeconfigFromUser()
+	}
+	if opts.From != "" || opts.Context != "" {
+		baseDir, _ := os.Getwd()
+		if opts.From != "" {
+			baseDir = filepath.Dir(expandHome(opts.From))
+		}
+		extracted, err := importKubeconfigContext(kubeconfig, opts.Context, baseDir)
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			return exitInvalidKubeconfig
+		}
+		kubeconfig = extracted
+	}
 	if !validateKubeconfig(kubeconfig) {
 		fmt.Println("❌ Invalid kubeconfig provided. Please check and try again.")
-		return
+		return exitInvalidKubeconfig
 	}
 
 	// 3. Save kubeconfig
-	saveKubeconfig(kubeconfig)
+	if code := saveKubeconfig(kubeconfig, opts.Force); code != exitOK {
+		return code
+	}
+
+	// 4. Make sure kubectl can talk to the cluster's version
+	if kubeconfigPath := getKubeConfig(); kubeconfigPath != "" {
+		checkKubectlCompatibility(kubeconfigPath, true)
+	}
 
-	// 4. Install VSCode extensions if available
-	installVSCodeExtensions()
+	// 5. Install VSCode extensions if available
+	if opts.NoVSCode {
+		fmt.Println("Skipping VSCode extensions (--no-vscode)")
+	} else {
+		installVSCodeExtensions()
+	}
 
-	// 5. Get partition information
+	// 6. Get partition information
 	partitions := getPartitions()
 	if partitions == nil {
 		fmt.Println("❌ Failed to get partition information. Please check your network connection.")
-		return
+		return exitPartitionsFailed
 	}
 
-	// 6. Display partition information
+	// 7. Display partition information
 	listPartitions(partitions)
 
 	fmt.Println("✅ Installation complete")
-}
-
-func checkKubectlInstalled() bool {
-	_, err := exec.LookPath("kubectl")
-	return err == nil
-}
-
-func installKubectl() {
-	fmt.Println("Installing kubectl...")
-
-	var cmd *exec.Cmd
-
-	// TODO: Update kubectl version as needed
-	kubectlVersion := "v1.32.3"
-
-	switch runtime.GOOS {
-	case "darwin": // macOS
-		if checkCommandExists("brew") {
-			cmd = exec.Command("brew", "install", "kubectl")
-		} else {
-			fmt.Println("Please install Homebrew first: https://brew.sh/")
-			return
-		}
-
-	case "linux":
-		// Ask user where to install kubectl
-		fmt.Println("Where would you like to install kubectl?")
-		fmt.Println("1. /usr/local/bin [Default]")
-		fmt.Println("2. ~/.hpcgame/bin")
-		fmt.Print("Choose option (1/2): ")
-		scanner := bufio.NewScanner(os.Stdin)
-		scanner.Scan()
-		option := scanner.Text()
-		var installPath string
-		if option == "2" {
-			homeDir, err := os.UserHomeDir()
-			if err != nil {
-				fmt.Printf("Failed to get user home directory: %s\n", err)
-				return
-			}
-			installPath = filepath.Join(homeDir, kubeconfigDir, "bin")
-			err = os.MkdirAll(installPath, 0700)
-			if err != nil {
-				fmt.Printf("Failed to create directory: %s\n", err)
-				return
-			}
-			fmt.Printf("Please add %s to your PATH\n", installPath)
-		} else {
-			installPath = "/usr/local/bin"
-		}
-		cmd = exec.Command("bash", "-c",
-			"curl -LO https://dl.k8s.io/release/"+string(kubectlVersion)+"/bin/linux/amd64/kubectl && "+
-				"chmod +x kubectl && "+
-				"sudo mv kubectl "+installPath)
-		if option == "2" {
-			fmt.Printf("Would you like to add %s to PATH by modifying .bashrc and .zshrc? (Y/n): ", installPath)
-			scanner.Scan()
-			addToPath := scanner.Text()
-			// Modify PATH for current session
-			os.Setenv("PATH", os.Getenv("PATH")+":"+installPath)
-			if addToPath != "Y" && addToPath != "y" && addToPath != "" {
-				fmt.Printf("Please manually add %s to your PATH\n", installPath)
-			} else {
-				// Add to .bashrc
-				bashrcPath := filepath.Join(os.Getenv("HOME"), ".bashrc")
-				zshrcPath := filepath.Join(os.Getenv("HOME"), ".zshrc")
-				if _, err := os.Stat(bashrcPath); err == nil {
-					f, err := os.OpenFile(bashrcPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-					if err != nil {
-						fmt.Printf("Failed to open .bashrc: %s\n", err)
-						return
-					}
-					defer f.Close()
-					if _, err := f.WriteString(fmt.Sprintf("\nexport PATH=$PATH:%s\n", installPath)); err != nil {
-						fmt.Printf("Failed to write to .bashrc: %s\n", err)
-						return
-					}
-					fmt.Printf("Added %s to .bashrc\n", installPath)
-				}
-				// Add to .zshrc if it exists
-				if _, err := os.Stat(zshrcPath); err == nil {
-					f, err := os.OpenFile(zshrcPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-					if err != nil {
-						fmt.Printf("Failed to open .zshrc: %s\n", err)
-						return
-					}
-					defer f.Close()
-					if _, err := f.WriteString(fmt.Sprintf("\nexport PATH=$PATH:%s\n", installPath)); err != nil {
-						fmt.Printf("Failed to write to .zshrc: %s\n", err)
-						return
-					}
-					fmt.Printf("Added %s to .zshrc\n", installPath)
-				}
-			}
-		}
-
-	case "windows":
-		// For Windows, try winget first, then manual download
-		cmd = exec.Command("powershell", "-Command",
-			"if (Get-Command winget -ErrorAction SilentlyContinue) { "+
-				"winget install --id Kubernetes.kubectl -e } else { "+
-				"$url = \"https://dl.k8s.io/release/"+string(kubectlVersion)+"/bin/windows/amd64/kubectl.exe\"; "+
-				"$output = 'kubectl.exe'; "+
-				"Invoke-WebRequest -Uri $url -OutFile $output; "+
-				"Write-Host 'Please move kubectl.exe to a directory in your PATH, such as C:\\Windows\\System32'; "+
-				"Write-Host 'Or manually install kubectl from: https://kubernetes.io/docs/tasks/tools/install-kubectl-windows/'; }")
-
-	default:
-		fmt.Printf("Unsupported operating system: %s\n", runtime.GOOS)
-		return
-	}
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Printf("Failed to install kubectl: %s\n%s\n", err, string(output))
-		return
-	}
-
-	fmt.Println("✅ kubectl installed successfully")
+	return exitOK
 }
 
 func listPartitions(partitions []Partition) {
@@ -346,6 +533,15 @@ func listImages() {
 		return
 	}
 
+	if outputJSON() {
+		images := map[string][]string{}
+		for _, partition := range partitions {
+			images[partition.Name] = partition.Images
+		}
+		printJSON(images)
+		return
+	}
+
 	fmt.Println("Available images by partition:")
 	fmt.Println("------------------------------------------------")
 	for _, partition := range partitions {
@@ -373,10 +569,10 @@ func shellContainer() {
 	containerName := os.Args[2]
 	fmt.Printf("Connecting to container %s...\n", containerName)
 
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "exec", "-it", containerName, "--", "/bin/bash")
+	cmd := kubectlCommand(kubeconfigPath, "exec", "-it", containerName, "--", "/bin/bash")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = watchExecCredentials(os.Stderr)
 	if err := cmd.Run(); err != nil {
 		fmt.Printf("Failed to connect to container: %s\n", err)
 		return
@@ -432,7 +628,7 @@ func execInContainer() {
 	fmt.Printf("Executing in container %s: %s\n", containerName, strings.Join(cmdArgs, " "))
 
 	// Build kubectl command
-	kubectlArgs := []string{"--kubeconfig", kubeconfigPath, "exec"}
+	kubectlArgs := []string{"exec"}
 	if interactive && tty {
 		kubectlArgs = append(kubectlArgs, "-it")
 	} else {
@@ -446,7 +642,7 @@ func execInContainer() {
 	kubectlArgs = append(kubectlArgs, containerName, "--")
 	kubectlArgs = append(kubectlArgs, cmdArgs...)
 
-	cmd := exec.Command("kubectl", kubectlArgs...)
+	cmd := kubectlCommand(kubeconfigPath, kubectlArgs...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -456,104 +652,15 @@ func execInContainer() {
 	}
 }
 
-func copyFiles() {
-	kubeconfigPath := getKubeConfig()
-	if kubeconfigPath == "" {
-		return
-	}
-
-	if len(os.Args) < 4 {
-		fmt.Println("Source and destination required")
-		fmt.Println("Usage: hpcgame cp SOURCE DEST")
-		fmt.Println("Examples:")
-		fmt.Println("  hpcgame cp ./local-file.txt container:/path/to/file.txt")
-		fmt.Println("  hpcgame cp container:/path/to/file.txt ./local-copy.txt")
-		return
-	}
-
-	source := os.Args[2]
-	destination := os.Args[3]
-
-	// Handle containers with missing paths
-	if strings.Contains(destination, ":") && strings.HasSuffix(destination, ":") {
-		containerName := strings.TrimSuffix(destination, ":")
-		destination = containerName + ":~/"
-		fmt.Printf("⚠️ No destination path specified, copying to home directory of container %s\n", containerName)
-	}
-
-	// Check for invalid source path
-	if strings.Contains(source, ":") && strings.HasSuffix(source, ":") {
-		fmt.Println("❌ Error: Source file path cannot be empty")
-		fmt.Println("Usage: hpcgame cp SOURCE DEST")
-		return
-	}
-
-	fmt.Printf("Copying: %s -> %s\n", source, destination)
-
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "cp", source, destination)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Failed to copy files: %s\n", err)
-		return
-	}
-
-	fmt.Println("✅ File copied successfully")
-}
-
-func portForward() {
-	kubeconfigPath := getKubeConfig()
-	if kubeconfigPath == "" {
-		return
-	}
-
-	if len(os.Args) < 3 {
-		fmt.Println("Container name and port mapping required")
-		fmt.Println("Usage: hpcgame port CONTAINER LOCAL_PORT:CONTAINER_PORT")
-		fmt.Println("Example: hpcgame port my-container 8080:80")
-		return
-	}
-
-	containerName := os.Args[2]
-	var portMapping string
-
-	if len(os.Args) > 3 {
-		portMapping = os.Args[3]
-	} else {
-		// Check if container name contains port mapping
-		parts := strings.Split(containerName, " ")
-		if len(parts) > 1 {
-			containerName = parts[0]
-			portMapping = parts[1]
-		} else {
-			fmt.Println("Port mapping required")
-			fmt.Println("Usage: hpcgame port CONTAINER LOCAL_PORT:CONTAINER_PORT")
-			return
-		}
-	}
-
-	fmt.Printf("Setting up port forwarding: %s %s\n", containerName, portMapping)
-	fmt.Println("Press Ctrl+C to stop forwarding")
-
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "port-forward", "pod/"+containerName, portMapping)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Failed to set up port forwarding: %s\n", err)
-		return
-	}
-}
-
 func getPartitions() []Partition {
-	// Get the user's home directory
-	homeDir, err := os.UserHomeDir()
+	// Get the directory of the active profile
+	hpcgameDir, err := profileDir(currentProfile())
 	if err != nil {
 		fmt.Printf("Failed to get user home directory: %s\n", err)
 		return nil
 	}
 
 	// Create ~/.hpcgame directory if it doesn't exist
-	hpcgameDir := filepath.Join(homeDir, kubeconfigDir)
 	if _, err := os.Stat(hpcgameDir); os.IsNotExist(err) {
 		err := os.MkdirAll(hpcgameDir, 0700)
 		if err != nil {
@@ -583,7 +690,7 @@ func getPartitions() []Partition {
 
 	if needsUpdate {
 		// Update partitions from the server
-		resp, err := http.Get("https://hpcgame.pku.edu.cn/oss/images/public/partitions.json")
+		resp, err := http.Get(loadSettings().String("partition_source"))
 		if err != nil {
 			fmt.Printf("Failed to get partition information: %s\n", err)
 			return nil
@@ -640,7 +747,7 @@ func checkCommandExists(cmd string) bool {
 }
 
 func getKubeconfigFromUser() string {
-	fmt.Println("Please enter your kubeconfig content. You can get it from https://hpcgame.pku.edu.cn/kube/_/ui/#/tokens/")
+	fmt.Printf("Please enter your kubeconfig content. You can get it from %s\n", tokensURL)
 	fmt.Println("Press Ctrl+D (Linux/macOS) or Ctrl+Z (Windows) when finished:")
 
 	var kubeconfig strings.Builder
@@ -669,7 +776,7 @@ func validateKubeconfig(kubeconfig string) bool {
 	tmpFile.Close()
 
 	// Validate kubeconfig by trying to list nodes
-	cmd := exec.Command("kubectl", "--kubeconfig", tmpFile.Name(), "get", "nodes")
+	cmd := exec.Command(kubectlBinary(), "--kubeconfig", tmpFile.Name(), "get", "nodes")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -677,6 +784,9 @@ func validateKubeconfig(kubeconfig string) bool {
 
 	if err != nil {
 		fmt.Printf("Kubeconfig validation failed: %s\n%s\n", err, stderr.String())
+		if isUnauthorized(stderr.String()) {
+			fmt.Printf("The token was rejected, generate a new one at %s\n", tokensURL)
+		}
 		return false
 	}
 
@@ -684,49 +794,57 @@ func validateKubeconfig(kubeconfig string) bool {
 	return true
 }
 
-func saveKubeconfig(kubeconfig string) {
-	homeDir, err := os.UserHomeDir()
+// saveKubeconfig writes the kubeconfig of the active profile. An existing file
+// is only replaced if overwrite is set or the user confirms; in --yes mode
+// the existing file is kept unless overwrite is set. It returns the exit code
+// for install: exitKubeconfigExists if the file was kept, exitFailure if it
+// could not be written.
+func saveKubeconfig(kubeconfig string, overwrite bool) int {
+	configDir, err := profileDir(currentProfile())
 	if err != nil {
 		fmt.Printf("Failed to get user home directory: %s\n", err)
-		return
+		return exitFailure
 	}
 
-	configDir := filepath.Join(homeDir, kubeconfigDir)
 	err = os.MkdirAll(configDir, 0700)
 	if err != nil {
 		fmt.Printf("Failed to create config directory: %s\n", err)
-		return
+		return exitFailure
 	}
 
 	kubeconfigPath := filepath.Join(configDir, kubeconfigFile)
 
 	// Check if file already exists
-	if _, err := os.Stat(kubeconfigPath); err == nil {
+	if kubeconfigEncrypted(currentProfile()) {
+		kubeconfigPath = filepath.Join(configDir, encryptedKubeconfigFile)
+	}
+	if _, err := os.Stat(kubeconfigPath); err == nil && !overwrite {
 		fmt.Printf("Kubeconfig file already exists at %s\n", kubeconfigPath)
-		fmt.Print("Overwrite? (y/n): ")
-
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Failed to read input: %s\n", err)
-			return
+		if assumeYes {
+			fmt.Println("❌ Refusing to overwrite it without --force")
+			return exitKubeconfigExists
 		}
-
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response != "y" && response != "yes" {
+		if !askYesNo("Overwrite?") {
 			fmt.Println("Operation cancelled")
-			return
+			return exitKubeconfigExists
 		}
 	}
 
-	// Write kubeconfig
-	err = os.WriteFile(kubeconfigPath, []byte(kubeconfig), 0600)
+	// Write kubeconfig, encrypted with the existing passphrase if it was encrypted
+	kubeconfigPath, err = writeStoredKubeconfig(currentProfile(), []byte(kubeconfig))
 	if err != nil {
 		fmt.Printf("Failed to save kubeconfig: %s\n", err)
-		return
+		return exitFailure
 	}
 
+	recordArtifact(manifestEntry{Kind: artifactFile, Path: kubeconfigPath})
 	fmt.Printf("✅ Kubeconfig saved to %s\n", kubeconfigPath)
+	return exitOK
+}
+
+var vscodeExtensions = []string{
+	"ms-kubernetes-tools.vscode-kubernetes-tools",
+	"ms-vscode-remote.remote-containers",
 }
 
 func installVSCodeExtensions() {
@@ -740,14 +858,22 @@ func installVSCodeExtensions() {
 		return
 	}
 
-	extensions := []string{
-		"ms-kubernetes-tools.vscode-kubernetes-tools",
-		"ms-vscode-remote.remote-containers",
+	fmt.Println("Installing VSCode extensions...")
+
+	// Only extensions installed here are recorded for uninstall
+	installed := map[string]bool{}
+	if output, err := exec.Command("code", "--list-extensions").Output(); err == nil {
+		for _, ext := range strings.Fields(string(output)) {
+			installed[strings.ToLower(ext)] = true
+		}
 	}
 
-	fmt.Println("Installing VSCode extensions...")
+	for _, ext := range vscodeExtensions {
+		if installed[strings.ToLower(ext)] {
+			fmt.Printf("✅ Extension %s already installed\n", ext)
+			continue
+		}
 
-	for _, ext := range extensions {
 		cmd := exec.Command("code", "--install-extension", ext)
 		var stdout, stderr bytes.Buffer
 		cmd.Stdout = &stdout
@@ -757,25 +883,48 @@ func installVSCodeExtensions() {
 		if err != nil {
 			fmt.Printf("Failed to install extension %s: %s\n%s\n", ext, err, stderr.String())
 		} else {
+			recordArtifact(manifestEntry{Kind: artifactExtension, Path: ext})
 			fmt.Printf("✅ Installed extension %s\n", ext)
 		}
 	}
 }
 
 func getKubeConfig() string {
-	homeDir, err := os.UserHomeDir()
+	profile := currentProfile()
+	if !profileExists(profile) {
+		fmt.Printf("Profile %s does not exist. Use 'hpcgame profile ls' to list profiles\n", profile)
+		return ""
+	}
+
+	hpcgameDir, err := profileDir(profile)
 	if err != nil {
 		fmt.Printf("Failed to get user home directory: %s\n", err)
 		return ""
 	}
 
-	kubeconfigPath := filepath.Join(homeDir, kubeconfigDir, kubeconfigFile)
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
+	kubeconfigPath := filepath.Join(hpcgameDir, kubeconfigFile)
+	if kubeconfigEncrypted(profile) {
+		data, err := readStoredKubeconfig(profile)
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			return ""
+		}
+		if kubeconfigPath, err = materializeKubeconfig(data); err != nil {
+			fmt.Printf("Failed to decrypt kubeconfig: %s\n", err)
+			return ""
+		}
+	} else if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
 		fmt.Printf("Kubeconfig not found: %s\n", kubeconfigPath)
-		fmt.Println("Please run 'hpcgame install' first")
+		if profile == defaultProfile {
+			fmt.Println("Please run 'hpcgame install' first")
+		} else {
+			fmt.Printf("Please run 'hpcgame --profile %s install' first\n", profile)
+		}
 		return ""
 	}
 
+	kubeconfigInUse = kubeconfigPath
+	warnTokenExpiry(kubeconfigPath)
 	return kubeconfigPath
 }
 
@@ -786,7 +935,7 @@ func runContainer() {
 	}
 
 	// Create new flag set for run command
-	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+	runCmd := flag.NewFlagSet("run", flag.ContinueOnError)
 
 	// Define command line options
 	partitionFlag := runCmd.String("partition", "", "Specify partition name")
@@ -809,7 +958,7 @@ func runContainer() {
 	runCmd.BoolVar(helpFlag, "h", false, "Show help information (short)")
 
 	// Parse arguments
-	if len(os.Args) < 3 {
+	if len(os.Args) < 3 && loadSettings().String("partition") == "" {
 		fmt.Println("Usage: hpcgame run [OPTIONS] [IMAGE]")
 		runCmd.PrintDefaults()
 		return
@@ -834,10 +983,8 @@ func runContainer() {
 		flagArgs = os.Args[2:]
 	}
 
-	err := runCmd.Parse(flagArgs)
-	if err != nil {
-		fmt.Printf("Failed to parse arguments: %s\n", err)
-		return
+	if err := runCmd.Parse(flagArgs); err != nil {
+		exit(exitUsage)
 	}
 
 	// Show help
@@ -848,6 +995,27 @@ func runContainer() {
 		return
 	}
 
+	// Fill in configured defaults for options not given on the command line
+	settings := loadSettings()
+	if !flagPassed(runCmd, "name", "n") {
+		*nameFlag = settings.String("name")
+	}
+	if !flagPassed(runCmd, "partition", "p") {
+		*partitionFlag = settings.String("partition")
+	}
+	if !flagPassed(runCmd, "cpu", "c") && settings.Int("cpu") > 0 {
+		*cpuFlag = settings.Int("cpu")
+	}
+	if !flagPassed(runCmd, "memory", "m") {
+		*memoryFlag = settings.Int("memory")
+	}
+	if !flagPassed(runCmd, "gpu", "g") {
+		*gpuFlag = settings.Int("gpu")
+	}
+	if !flagPassed(runCmd, "volume", "v") {
+		*volumeFlag = settings.String("volumes")
+	}
+
 	// Get partitions
 	partitions := getPartitions()
 	if partitions == nil {
@@ -917,6 +1085,11 @@ func runContainer() {
 		image = imageArg
 	}
 
+	if image == "" && settings.Image(partition) != "" {
+		image = settings.Image(partition)
+		fmt.Printf("Image not specified, using configured default: %s\n", image)
+	}
+
 	if image == "" {
 		if len(partitionStruct.Images) > 0 {
 			image = partitionStruct.Images[0]
@@ -945,18 +1118,13 @@ func runContainer() {
 
 		// Check if volumes exist
 		for _, vol := range extraVolumes {
-			cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pvc", vol)
+			cmd := kubectlCommand(kubeconfigPath, "get", "pvc", vol)
 			err := cmd.Run()
 			if err != nil {
 				fmt.Printf("Warning: Volume %s may not exist. Use 'hpcgame volume ls' to list available volumes\n", vol)
-				fmt.Print("Continue anyway? (y/n): ")
-				scanner := bufio.NewScanner(os.Stdin)
-				if scanner.Scan() {
-					response := strings.ToLower(scanner.Text())
-					if response != "y" && response != "yes" {
-						fmt.Println("Operation cancelled")
-						return
-					}
+				if !askConfirm("Continue anyway?") {
+					fmt.Println("Operation cancelled")
+					return
 				}
 			}
 		}
@@ -980,7 +1148,7 @@ func runContainer() {
 	fmt.Print("Waiting for container to start...")
 	for i := 0; i < 10; i++ {
 		fmt.Print(".")
-		cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pod", name, "-o", "jsonpath={.status.phase}")
+		cmd := kubectlCommand(kubeconfigPath, "get", "pod", name, "-o", "jsonpath={.status.phase}")
 		output, err := cmd.Output()
 		if err == nil && string(output) == "Running" {
 			fmt.Println("\n✅ Container is running!")
@@ -1074,7 +1242,7 @@ spec:
 `, name, partition.Name, image, cpu*1000, memory, gpulimit, cpu*1000, memory, gpulimit, volumeMountsStr, volumesStr)
 
 	// Print YAML config in debug mode
-	if os.Getenv("DEBUG") != "" {
+	if verbose() {
 		fmt.Printf("Generated YAML config:\n%s\n", yamlConfig)
 	}
 
@@ -1091,15 +1259,16 @@ spec:
 	tmpFile.Close()
 
 	// Apply config
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "apply", "-f", tmpFile.Name())
+	cmd := kubectlCommand(kubeconfigPath, "apply", "-f", tmpFile.Name())
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	cmd.Stderr = watchCredentials(&stderr)
 	err = cmd.Run()
 
 	if err != nil {
 		return fmt.Errorf("failed to deploy container: %s\n%s", err, stderr.String())
 	}
 
+	invalidateCompletionCache()
 	return nil
 }
 
@@ -1109,22 +1278,21 @@ func listContainers() {
 		return
 	}
 
-	fmt.Println("Retrieving container list...")
-
-	// Get current namespace
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "config", "view", "--minify", "-o", "jsonpath={..namespace}")
-	namespaceOutput, err := cmd.Output()
+	if !outputJSON() {
+		printProfileHeader()
+		fmt.Printf("Retrieving container list in namespace %s...\n", resolveNamespace(kubeconfigPath))
+	}
 
-	namespace := string(namespaceOutput)
-	if err != nil || namespace == "" {
-		namespace = "default"
+	if outputJSON() {
+		listContainersJSON(kubeconfigPath)
+		return
 	}
 
 	// Format output to be more Docker-like
-	cmd = exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pods", "-n", namespace,
+	cmd := kubectlCommand(kubeconfigPath, "get", "pods",
 		"-o", "custom-columns=CONTAINER:.metadata.name,IMAGE:.spec.containers[0].image,STATUS:.status.phase,CREATED:.metadata.creationTimestamp,NODE:.spec.nodeName")
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = watchCredentials(os.Stderr)
 
 	if err := cmd.Run(); err != nil {
 		fmt.Printf("Failed to get container list: %s\n", err)
@@ -1132,6 +1300,61 @@ func listContainers() {
 	}
 }
 
+func listContainersJSON(kubeconfigPath string) {
+	cmd := kubectlCommand(kubeconfigPath, "get", "pods", "-o", "json")
+	var stderr bytes.Buffer
+	cmd.Stderr = watchCredentials(&stderr)
+	output, err := cmd.Output()
+	if err != nil {
+		fmt.Printf("Failed to get container list: %s\n%s\n", err, stderr.String())
+		return
+	}
+
+	var podList struct {
+		Items []struct {
+			Metadata struct {
+				Name              string `json:"name"`
+				CreationTimestamp string `json:"creationTimestamp"`
+			} `json:"metadata"`
+			Spec struct {
+				NodeName   string `json:"nodeName"`
+				Containers []struct {
+					Image string `json:"image"`
+				} `json:"containers"`
+			} `json:"spec"`
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &podList); err != nil {
+		fmt.Printf("Failed to parse container list: %s\n", err)
+		return
+	}
+
+	type containerInfo struct {
+		Name    string `json:"name"`
+		Image   string `json:"image"`
+		Status  string `json:"status"`
+		Created string `json:"created"`
+		Node    string `json:"node"`
+	}
+	containers := []containerInfo{}
+	for _, pod := range podList.Items {
+		info := containerInfo{
+			Name:    pod.Metadata.Name,
+			Status:  pod.Status.Phase,
+			Created: pod.Metadata.CreationTimestamp,
+			Node:    pod.Spec.NodeName,
+		}
+		if len(pod.Spec.Containers) > 0 {
+			info.Image = pod.Spec.Containers[0].Image
+		}
+		containers = append(containers, info)
+	}
+	printJSON(containers)
+}
+
 func deleteContainer() {
 	kubeconfigPath := getKubeConfig()
 	if kubeconfigPath == "" {
@@ -1147,14 +1370,15 @@ func deleteContainer() {
 	containerName := os.Args[2]
 	fmt.Printf("Removing container %s...\n", containerName)
 
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "delete", "pod", containerName)
+	cmd := kubectlCommand(kubeconfigPath, "delete", "pod", containerName)
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = watchCredentials(os.Stderr)
 	if err := cmd.Run(); err != nil {
 		fmt.Printf("Failed to remove container: %s\n", err)
 		return
 	}
 
+	invalidateCompletionCache()
 	fmt.Printf("✅ Container %s removed\n", containerName)
 }
 
@@ -1166,10 +1390,10 @@ func ensurePartitionDefaultVolume(kubeconfigPath string, partition string) error
 	defaultVolumeName := fmt.Sprintf("%s-default-pvc", partitionDash)
 
 	// Check if volume already exists
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pvc", defaultVolumeName)
+	cmd := kubectlCommand(kubeconfigPath, "get", "pvc", defaultVolumeName)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stderr = watchCredentials(&stderr)
 	err := cmd.Run()
 
 	// If volume exists, return
@@ -1208,9 +1432,9 @@ spec:
 	tmpFile.Close()
 
 	// Apply volume config
-	cmd = exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "apply", "-f", tmpFile.Name())
+	cmd = kubectlCommand(kubeconfigPath, "apply", "-f", tmpFile.Name())
 	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stderr = watchCredentials(&stderr)
 	err = cmd.Run()
 
 	if err != nil {
@@ -1222,7 +1446,7 @@ spec:
 }
 
 func listVolumes(kubeconfigPath string) error {
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pvc", "-o", "json")
+	cmd := kubectlCommand(kubeconfigPath, "get", "pvc", "-o", "json")
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get volume list: %s", err)
@@ -1253,6 +1477,22 @@ func listVolumes(kubeconfigPath string) error {
 		return fmt.Errorf("failed to parse volume list: %s", err)
 	}
 
+	if outputJSON() {
+		volumes := []PersistentVolume{}
+		for _, pvc := range pvcList.Items {
+			volumes = append(volumes, PersistentVolume{
+				Name:         pvc.Metadata.Name,
+				Size:         pvc.Spec.Resources.Requests.Storage,
+				StorageClass: pvc.Spec.StorageClassName,
+				AccessMode:   strings.Join(pvc.Spec.AccessModes, ","),
+				Status:       pvc.Status.Phase,
+				IsDefault:    strings.Contains(pvc.Metadata.Name, "-default-pvc"),
+			})
+		}
+		printJSON(volumes)
+		return nil
+	}
+
 	fmt.Println("VOLUME LIST")
 	fmt.Println("===============================================================================")
 	fmt.Printf("%-25s %-15s %-20s %-15s %-10s %s\n", "NAME", "SIZE", "STORAGE CLASS", "ACCESS MODE", "STATUS", "NOTES")
@@ -1285,7 +1525,7 @@ func createContainer() {
 	}
 
 	// Create new flag set for create command
-	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
+	createCmd := flag.NewFlagSet("create", flag.ContinueOnError)
 
 	// Define command line options
 	partitionFlag := createCmd.String("partition", "", "Specify partition name")
@@ -1308,16 +1548,14 @@ func createContainer() {
 	createCmd.BoolVar(helpFlag, "h", false, "Show help information (short)")
 
 	// Parse arguments
-	if len(os.Args) < 3 {
+	if len(os.Args) < 3 && loadSettings().String("partition") == "" {
 		fmt.Println("Usage: hpcgame create [OPTIONS]")
 		createCmd.PrintDefaults()
 		return
 	}
 
-	err := createCmd.Parse(os.Args[2:])
-	if err != nil {
-		fmt.Printf("Failed to parse arguments: %s\n", err)
-		return
+	if err := createCmd.Parse(os.Args[2:]); err != nil {
+		exit(exitUsage)
 	}
 
 	// Show help
@@ -1328,6 +1566,27 @@ func createContainer() {
 		return
 	}
 
+	// Fill in configured defaults for options not given on the command line
+	settings := loadSettings()
+	if !flagPassed(createCmd, "name", "n") {
+		*nameFlag = settings.String("name")
+	}
+	if !flagPassed(createCmd, "partition", "p") {
+		*partitionFlag = settings.String("partition")
+	}
+	if !flagPassed(createCmd, "cpu", "c") && settings.Int("cpu") > 0 {
+		*cpuFlag = settings.Int("cpu")
+	}
+	if !flagPassed(createCmd, "memory", "m") {
+		*memoryFlag = settings.Int("memory")
+	}
+	if !flagPassed(createCmd, "gpu", "g") {
+		*gpuFlag = settings.Int("gpu")
+	}
+	if !flagPassed(createCmd, "volumes", "v") {
+		*volumesFlag = settings.String("volumes")
+	}
+
 	// Get partitions
 	partitions := getPartitions()
 	if partitions == nil {
@@ -1410,6 +1669,11 @@ func createContainer() {
 
 	// Handle image
 	image := *imageFlag
+	if image == "" && settings.Image(partition) != "" {
+		image = settings.Image(partition)
+		fmt.Printf("Image not specified, using configured default: %s\n", image)
+	}
+
 	if image == "" {
 		if len(partitionStruct.Images) > 0 {
 			image = partitionStruct.Images[0]
@@ -1438,18 +1702,13 @@ func createContainer() {
 
 		// Check if volumes exist
 		for _, vol := range extraVolumes {
-			cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "get", "pvc", vol)
+			cmd := kubectlCommand(kubeconfigPath, "get", "pvc", vol)
 			err := cmd.Run()
 			if err != nil {
 				fmt.Printf("Warning: Volume %s may not exist. Use 'hpcgame volume ls' to list available volumes\n", vol)
-				fmt.Print("Continue anyway? (y/n): ")
-				scanner := bufio.NewScanner(os.Stdin)
-				if scanner.Scan() {
-					response := strings.ToLower(scanner.Text())
-					if response != "y" && response != "yes" {
-						fmt.Println("Operation cancelled")
-						return
-					}
+				if !askConfirm("Continue anyway?") {
+					fmt.Println("Operation cancelled")
+					return
 				}
 			}
 		}
@@ -1512,15 +1771,16 @@ spec:
 	tmpFile.Close()
 
 	// Apply volume config
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "apply", "-f", tmpFile.Name())
+	cmd := kubectlCommand(kubeconfigPath, "apply", "-f", tmpFile.Name())
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	cmd.Stderr = watchCredentials(&stderr)
 	err = cmd.Run()
 
 	if err != nil {
 		return fmt.Errorf("failed to create volume: %s\n%s", err, stderr.String())
 	}
 
+	invalidateCompletionCache()
 	fmt.Printf("✅ Volume %s created\n", name)
 	return nil
 }
@@ -1532,15 +1792,16 @@ func deleteVolume(kubeconfigPath string, name string) error {
 	}
 
 	// Delete volume
-	cmd := exec.Command("kubectl", "--kubeconfig", kubeconfigPath, "delete", "pvc", name)
+	cmd := kubectlCommand(kubeconfigPath, "delete", "pvc", name)
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	cmd.Stderr = watchCredentials(&stderr)
 	err := cmd.Run()
 
 	if err != nil {
 		return fmt.Errorf("failed to delete volume: %s\n%s", err, stderr.String())
 	}
 
+	invalidateCompletionCache()
 	fmt.Printf("✅ Volume %s deleted\n", name)
 	return nil
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// portMapping forwards local to remote; an empty local port is chosen by
+// kubectl and filled in once it is known
+type portMapping struct {
+	local  string
+	remote string
+}
+
+func (m portMapping) String() string {
+	return m.local + ":" + m.remote
+}
+
+// parsePortMapping accepts LOCAL:REMOTE, :REMOTE for a random local port and
+// PORT for the same port on both sides
+func parsePortMapping(s string) (portMapping, error) {
+	local, remote, found := strings.Cut(s, ":")
+	if !found {
+		local, remote = s, s
+	}
+	if local != "" {
+		if port, err := strconv.Atoi(local); err != nil || port < 1 || port > 65535 {
+			return portMapping{}, fmt.Errorf("invalid local port in %s", s)
+		}
+	}
+	// Services may name their ports
+	if port, err := strconv.Atoi(remote); remote == "" || (err == nil && (port < 1 || port > 65535)) {
+		return portMapping{}, fmt.Errorf("invalid container port in %s", s)
+	}
+	return portMapping{local: local, remote: remote}, nil
+}
+
+// forwardTarget turns CONTAINER, svc/NAME or service/NAME into the resource
+// kubectl port-forward expects
+func forwardTarget(target string) string {
+	kind, name, found := strings.Cut(target, "/")
+	switch {
+	case !found:
+		return "pod/" + target
+	case kind == "svc" || kind == "service" || kind == "services":
+		return "service/" + name
+	}
+	return target
+}
+
+const (
+	maxForwardRetryDelay = 30 * time.Second
+
+	// forwardStableAfter is how long a connection has to last for the retry
+	// delay to start over
+	forwardStableAfter = 30 * time.Second
+)
+
+// portForwarder runs kubectl port-forward for several mappings at once
+type portForwarder struct {
+	kubeconfig string
+	target     string // pod/NAME or service/NAME
+	namespace  string // if not the default one
+	address    string
+	mappings   []portMapping
+
+	// changed is called, if set, when the status below changes
+	changed func()
+
+	mu        sync.Mutex
+	status    string // connecting, forwarding or reconnecting
+	restarts  int
+	lastError string
+}
+
+func (f *portForwarder) setStatus(status string, lastError string) {
+	f.mu.Lock()
+	f.status, f.lastError = status, lastError
+	if status == "reconnecting" {
+		f.restarts++
+	}
+	f.mu.Unlock()
+	if f.changed != nil {
+		f.changed()
+	}
+}
+
+// name is the target as shown to the user: containers by their name
+func (f *portForwarder) name() string {
+	return strings.TrimPrefix(f.target, "pod/")
+}
+
+// forwardingLine is what kubectl prints for each listening address
+var forwardingLine = regexp.MustCompile(`^Forwarding from (.+):(\d+) -> (\S+)`)
+
+// run forwards until kubectl exits or stop is closed, and reports whether
+// any port was forwarded. Each local port is reported on out once kubectl
+// listens on it; ports chosen by kubectl are kept in the mappings, so that
+// running again binds the same ones.
+func (f *portForwarder) run(out io.Writer, stop <-chan struct{}) (bool, error) {
+	f.mu.Lock()
+	args := []string{"port-forward", "--address", f.address, f.target}
+	if f.namespace != "" {
+		args = append(args, "--namespace", f.namespace)
+	}
+	for _, m := range f.mappings {
+		args = append(args, m.String())
+	}
+	f.mu.Unlock()
+
+	cmd := kubectlCommand(f.kubeconfig, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = watchCredentials(&stderr)
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-stop:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	reported := map[string]bool{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		match := forwardingLine.FindStringSubmatch(line)
+		if match == nil {
+			// "Handling connection for PORT" for every connection
+			debugf("%s", line)
+			continue
+		}
+		local, remote := match[2], match[3]
+		if reported[local] {
+			// The same port on another address, such as [::1]
+			continue
+		}
+		reported[local] = true
+		f.mu.Lock()
+		for i := range f.mappings {
+			if f.mappings[i].remote == remote && f.mappings[i].local == "" {
+				f.mappings[i].local = local
+				break
+			}
+		}
+		f.mu.Unlock()
+		fmt.Fprintf(out, "✅ Forwarding %s -> %s:%s\n", forwardAddress(f.address, match[1], local), f.name(), remote)
+		if len(reported) == len(f.mappings) {
+			f.setStatus("forwarding", "")
+		}
+	}
+
+	forwarded := len(reported) > 0
+	if err := cmd.Wait(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return forwarded, fmt.Errorf("%s", message)
+		}
+		return forwarded, err
+	}
+	return forwarded, nil
+}
+
+// forward keeps the ports forwarded until stop is closed. Whenever kubectl
+// exits, for example because the connection dropped or the container was
+// recreated, it is started again after a growing delay. Only a first attempt
+// that forwards nothing fails, as the target or a port is probably wrong.
+func (f *portForwarder) forward(out io.Writer, stop <-chan struct{}) error {
+	f.setStatus("connecting", "")
+	delay := time.Second
+	for first := true; ; first = false {
+		started := time.Now()
+		forwarded, err := f.run(out, stop)
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if first && !forwarded {
+			if err == nil {
+				err = fmt.Errorf("kubectl port-forward exited")
+			}
+			return err
+		}
+		if time.Since(started) > forwardStableAfter {
+			delay = time.Second
+		}
+
+		reason := "connection closed"
+		if err != nil {
+			reason = err.Error()
+		}
+		f.setStatus("reconnecting", reason)
+		fmt.Fprintf(out, "⚠️ [%s] Port forwarding to %s stopped: %s\n", time.Now().Format("15:04:05"), f.name(), reason)
+		fmt.Fprintf(out, "Reconnecting in %s\n", delay)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxForwardRetryDelay)
+	}
+}
+
+// forwardAddress shows where a forwarded port can be reached
+func forwardAddress(address string, listening string, port string) string {
+	switch address {
+	case "localhost", "":
+		return "localhost:" + port
+	case "0.0.0.0", "::":
+		return "*:" + port
+	}
+	return listening + ":" + port
+}
+
+func printPortHelp() {
+	fmt.Println("Usage: hpcgame port [OPTIONS] TARGET [LOCAL:]PORT...")
+	fmt.Println("       hpcgame port ls")
+	fmt.Println("       hpcgame port stop ID|TARGET|--all")
+	fmt.Println("TARGET is a container name or svc/NAME for a Service. Forwarding is")
+	fmt.Println("restarted automatically when the connection drops or the container is")
+	fmt.Println("recreated with the same name.")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  hpcgame port my-container 8080:80")
+	fmt.Println("  hpcgame port my-container -p 8888:8888 -p 6006:6006")
+	fmt.Println("  hpcgame port my-container :8888                  (random local port)")
+	fmt.Println("  hpcgame port --address 0.0.0.0 my-container 8888  (reachable from the LAN)")
+	fmt.Println("  hpcgame port svc/my-service 8080:80")
+	fmt.Println("  hpcgame port -d my-container 8888                 (in the background)")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -d, --detach                Forward in the background, see 'hpcgame port ls'")
+	fmt.Println("  -p, --publish [LOCAL:]PORT  Forward a port, may be repeated")
+	fmt.Println("  --address ADDRESS           Local addresses to listen on, comma-separated (default localhost)")
+}
+
+func portForward() {
+	if len(os.Args) > 2 {
+		switch os.Args[2] {
+		case "ls", "list":
+			listForwards()
+			return
+		case "stop", "rm":
+			stopForwards(os.Args[3:])
+			return
+		}
+	}
+
+	portCmd := flag.NewFlagSet("port", flag.ContinueOnError)
+	var publish stringList
+	portCmd.Var(&publish, "publish", "Forward a port, may be repeated")
+	portCmd.Var(&publish, "p", "Forward a port, may be repeated (short)")
+	address := portCmd.String("address", "localhost", "Local addresses to listen on, comma-separated")
+	detach := portCmd.Bool("detach", false, "Forward in the background")
+	portCmd.BoolVar(detach, "d", false, "Forward in the background (short)")
+	// Used by --detach to run the supervisor
+	supervise := portCmd.String("supervise", "", "")
+	portCmd.Usage = printPortHelp
+	args := parseInterspersed(portCmd, os.Args[2:])
+
+	// Check if container name contains port mapping
+	if len(args) == 1 && strings.Contains(args[0], " ") {
+		args = strings.Fields(args[0])
+	}
+	if len(args) == 0 {
+		fmt.Println("Container name and port mapping required")
+		printPortHelp()
+		exit(exitUsage)
+	}
+
+	target := args[0]
+	specs := append(args[1:], publish...)
+	if len(specs) == 0 {
+		fmt.Println("Port mapping required")
+		printPortHelp()
+		exit(exitUsage)
+	}
+	var mappings []portMapping
+	for _, spec := range specs {
+		m, err := parsePortMapping(spec)
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			exit(exitUsage)
+		}
+		mappings = append(mappings, m)
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+
+	forwarder := &portForwarder{
+		kubeconfig: kubeconfigPath,
+		target:     forwardTarget(target),
+		address:    *address,
+		mappings:   mappings,
+	}
+	if *supervise != "" {
+		if err := superviseForward(forwarder, *supervise); err != nil {
+			fmt.Printf("❌ Port forwarding failed: %s\n", err)
+			exit(exitFailure)
+		}
+		return
+	}
+
+	fmt.Printf("Setting up port forwarding to %s\n", forwarder.name())
+	if *address != "localhost" && *address != "127.0.0.1" && *address != "::1" {
+		fmt.Printf("⚠️ Listening on %s, the ports are reachable from other machines\n", *address)
+	}
+	if *detach {
+		if err := startBackgroundForward(forwarder, resolveNamespace(kubeconfigPath)); err != nil {
+			fmt.Printf("❌ Port forwarding failed: %s\n", err)
+			exit(exitFailure)
+		}
+		return
+	}
+	fmt.Println("Press Ctrl+C to stop forwarding")
+
+	if err := forwarder.forward(os.Stdout, nil); err != nil {
+		fmt.Printf("❌ Port forwarding failed: %s\n", err)
+		exit(exitFailure)
+	}
+}
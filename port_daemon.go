@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	forwardsDir = "forwards"
+
+	// forwardStartTimeout is how long port -d waits for the ports to be
+	// forwarded before giving up
+	forwardStartTimeout = 30 * time.Second
+)
+
+// forwardState describes a background port forward. The supervisor keeps it
+// up to date in the profile's forwards directory and removes it on exit.
+type forwardState struct {
+	ID        string    `json:"id"`
+	PID       int       `json:"pid"`
+	Target    string    `json:"target"`
+	Namespace string    `json:"namespace"`
+	Address   string    `json:"address"`
+	Ports     []string  `json:"ports"`
+	Status    string    `json:"status"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Started   time.Time `json:"started"`
+	Log       string    `json:"log"`
+
+	// Kubeconfig is the decrypted kubeconfig of the supervisor, removed by
+	// whoever has to kill it
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+func forwardsPath() (string, error) {
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, forwardsDir), nil
+}
+
+func (s *forwardState) save() error {
+	dir, err := forwardsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, s.ID+".json"), data, 0600)
+}
+
+func (s *forwardState) remove() {
+	if dir, err := forwardsPath(); err == nil {
+		os.Remove(filepath.Join(dir, s.ID+".json"))
+	}
+}
+
+// removeKubeconfig deletes the decrypted kubeconfig of a supervisor that
+// was killed and could not clean up
+func (s *forwardState) removeKubeconfig() {
+	if s.Kubeconfig != "" && strings.HasPrefix(filepath.Base(s.Kubeconfig), "hpcgame-kubeconfig-") {
+		os.Remove(s.Kubeconfig)
+	}
+}
+
+func (s *forwardState) name() string {
+	return strings.TrimPrefix(s.Target, "pod/")
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess only succeeds for running processes on Windows
+		process.Release()
+		return true
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// loadForwardState reads the state of one background forward, nil if it does
+// not exist
+func loadForwardState(id string) *forwardState {
+	dir, err := forwardsPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil
+	}
+	state := &forwardState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil
+	}
+	return state
+}
+
+// loadForwards returns the background forwards that are still running, and
+// forgets those whose supervisor is gone
+func loadForwards() []*forwardState {
+	dir, err := forwardsPath()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var forwards []*forwardState
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		state := loadForwardState(id)
+		if state == nil || !processAlive(state.PID) {
+			if state != nil {
+				state.removeKubeconfig()
+			}
+			os.Remove(filepath.Join(dir, entry.Name()))
+			os.Remove(filepath.Join(dir, id+".log"))
+			continue
+		}
+		forwards = append(forwards, state)
+	}
+	sort.Slice(forwards, func(i, j int) bool { return forwards[i].Started.Before(forwards[j].Started) })
+	return forwards
+}
+
+// startBackgroundForward starts a supervisor process for the forwarder and
+// waits until it forwards the ports
+func startBackgroundForward(f *portForwarder, namespace string) error {
+	dir, err := forwardsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(suffix)
+
+	logPath := filepath.Join(dir, id+".log")
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"--profile", currentProfile(), "--namespace", namespace, "port", "--supervise", id, "--address", f.address, f.target}
+	for _, m := range f.mappings {
+		args = append(args, m.String())
+	}
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	deadline := time.Now().Add(forwardStartTimeout)
+wait:
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			break wait
+		case <-time.After(200 * time.Millisecond):
+		}
+		state := loadForwardState(id)
+		if state != nil && state.Status == "forwarding" {
+			fmt.Printf("✅ Forwarding in the background as %s (PID %d)\n", id, state.PID)
+			for _, port := range state.Ports {
+				local, remote, _ := strings.Cut(port, ":")
+				fmt.Printf("  %s -> %s:%s\n", forwardAddress(state.Address, state.Address, local), state.name(), remote)
+			}
+			fmt.Printf("Stop it with 'hpcgame port stop %s'\n", id)
+			return nil
+		}
+	}
+
+	// Failed or too slow: stop the supervisor and show what it printed
+	message := "port forwarding did not start in time"
+	state := loadForwardState(id)
+	if state != nil && state.LastError != "" {
+		message = state.LastError
+	} else if data, err := os.ReadFile(logPath); err == nil && len(data) > 0 && processExited(exited) {
+		message = strings.TrimSpace(string(data))
+	}
+	if state == nil {
+		state = &forwardState{ID: id, Log: logPath}
+	}
+	if !processExited(exited) {
+		// Ask the supervisor to stop so that it ends kubectl and cleans up
+		if runtime.GOOS == "windows" {
+			cmd.Process.Kill()
+		} else {
+			cmd.Process.Signal(syscall.SIGTERM)
+		}
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+	}
+	state.remove()
+	state.removeKubeconfig()
+	os.Remove(logPath)
+	return fmt.Errorf("%s", message)
+}
+
+// processExited reports whether exited is closed
+func processExited(exited <-chan struct{}) bool {
+	select {
+	case <-exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// superviseForward runs a background forward started by port -d until it is
+// stopped with port stop
+func superviseForward(f *portForwarder, id string) error {
+	dir, err := forwardsPath()
+	if err != nil {
+		return err
+	}
+	state := &forwardState{
+		ID:         id,
+		PID:        os.Getpid(),
+		Target:     f.target,
+		Namespace:  resolveNamespace(f.kubeconfig),
+		Address:    f.address,
+		Started:    time.Now(),
+		Log:        filepath.Join(dir, id+".log"),
+		Kubeconfig: tempKubeconfig,
+	}
+	f.changed = func() {
+		f.mu.Lock()
+		state.Status, state.Restarts, state.LastError = f.status, f.restarts, f.lastError
+		state.Ports = nil
+		for _, m := range f.mappings {
+			state.Ports = append(state.Ports, m.String())
+		}
+		f.mu.Unlock()
+		state.save()
+	}
+
+	// Like the agent, the supervisor outlives the terminal that started it.
+	// SIGTERM stops forwarding and returns normally, so the decrypted
+	// kubeconfig is removed after kubectl exited.
+	signal.Reset(os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Ignore(os.Interrupt, syscall.SIGHUP)
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-terminate
+		close(stop)
+	}()
+
+	if err := f.forward(os.Stdout, stop); err != nil {
+		state.Status, state.LastError = "failed", err.Error()
+		state.save()
+		return err
+	}
+	state.remove()
+	os.Remove(state.Log)
+	return nil
+}
+
+// stopForward ends a background forward and waits for its supervisor to exit.
+// The supervisor is asked to stop so that it can end kubectl and clean up;
+// it is only killed if it does not exit in time, or on Windows.
+func stopForward(state *forwardState) error {
+	process, err := os.FindProcess(state.PID)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		err = process.Kill()
+	} else {
+		err = process.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 50 && processAlive(state.PID); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if processAlive(state.PID) {
+		process.Kill()
+	}
+	// On Windows the supervisor cannot clean up after itself
+	state.remove()
+	state.removeKubeconfig()
+	os.Remove(state.Log)
+	return nil
+}
+
+func listForwards() {
+	forwards := loadForwards()
+	if outputJSON() {
+		if forwards == nil {
+			forwards = []*forwardState{}
+		}
+		printJSON(forwards)
+		return
+	}
+	if len(forwards) == 0 {
+		fmt.Println("No port forwards running in the background")
+		return
+	}
+	fmt.Printf("%-10s %-24s %-24s %-8s %-10s %s\n", "ID", "TARGET", "PORTS", "PID", "UPTIME", "STATUS")
+	for _, state := range forwards {
+		status := state.Status
+		if state.Restarts > 0 {
+			status += fmt.Sprintf(" (reconnects: %d)", state.Restarts)
+		}
+		fmt.Printf("%-10s %-24s %-24s %-8d %-10s %s\n", state.ID, state.name(), strings.Join(state.Ports, ","),
+			state.PID, time.Since(state.Started).Round(time.Second), status)
+		if state.Status == "reconnecting" && state.LastError != "" {
+			fmt.Printf("%-10s %s\n", "", state.LastError)
+		}
+	}
+}
+
+// stopForwards stops the background forwards with the given IDs or targets,
+// or all of them
+func stopForwards(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Forward ID, container name or --all required")
+		fmt.Println("Usage: hpcgame port stop ID|CONTAINER|--all")
+		exit(exitUsage)
+	}
+	all := len(args) == 1 && (args[0] == "--all" || args[0] == "-a")
+	matched := 0
+	failed := false
+	for _, state := range loadForwards() {
+		selected := all
+		for _, arg := range args {
+			if arg == state.ID || arg == state.name() || forwardTarget(arg) == state.Target {
+				selected = true
+			}
+		}
+		if !selected {
+			continue
+		}
+		matched++
+		if err := stopForward(state); err != nil {
+			fmt.Printf("❌ Failed to stop %s: %s\n", state.ID, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("✅ Stopped %s (%s %s)\n", state.ID, state.name(), strings.Join(state.Ports, ","))
+	}
+	if matched == 0 {
+		fmt.Println("No matching port forwards, see 'hpcgame port ls'")
+		exit(exitFailure)
+	}
+	if failed {
+		exit(exitFailure)
+	}
+}
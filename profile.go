@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultProfile     = "default"
+	profilesDir        = "profiles"
+	currentProfileFile = "current-profile"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// profileFlag is set by the global --profile option
+var profileFlag string
+
+// currentProfile returns the active profile: --profile, then HPCGAME_PROFILE,
+// then the profile selected with 'hpcgame profile use'
+func currentProfile() string {
+	if profileFlag != "" {
+		return profileFlag
+	}
+	if profile := os.Getenv("HPCGAME_PROFILE"); profile != "" {
+		return profile
+	}
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return defaultProfile
+	}
+	data, err := os.ReadFile(filepath.Join(hpcgameDir, currentProfileFile))
+	if err != nil {
+		return defaultProfile
+	}
+	if profile := strings.TrimSpace(string(data)); profile != "" {
+		return profile
+	}
+	return defaultProfile
+}
+
+// profileDir returns the directory holding a profile's kubeconfig, config and
+// partition cache. The default profile lives directly in ~/.hpcgame so that
+// installations made before profiles existed keep working. Names come from
+// the command line and the environment, so anything that could leave
+// ~/.hpcgame/profiles is rejected.
+func profileDir(name string) (string, error) {
+	if name != defaultProfile && !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name: %s", name)
+	}
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	if name == defaultProfile {
+		return hpcgameDir, nil
+	}
+	return filepath.Join(hpcgameDir, profilesDir, name), nil
+}
+
+func profileConfigPath(name string) (string, error) {
+	dir, err := profileDir(name)
+	if err != nil {
+		return "", err
+	}
+	// The default profile shares the user config file
+	if name == defaultProfile {
+		return "", nil
+	}
+	return filepath.Join(dir, configFile), nil
+}
+
+func profileExists(name string) bool {
+	if name == defaultProfile {
+		return true
+	}
+	dir, err := profileDir(name)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+func listProfileNames() []string {
+	names := []string{defaultProfile}
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return names
+	}
+	entries, err := os.ReadDir(filepath.Join(hpcgameDir, profilesDir))
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && profileNamePattern.MatchString(entry.Name()) && entry.Name() != defaultProfile {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// printProfileHeader shows which profile a listing belongs to
+func printProfileHeader() {
+	fmt.Printf("Profile: %s\n", currentProfile())
+}
+
+func handleProfileCommands() {
+	if len(os.Args) < 3 {
+		printProfileHelp()
+		return
+	}
+
+	subCommand := os.Args[2]
+
+	switch subCommand {
+	case "ls", "list":
+		current := currentProfile()
+		fmt.Printf("%-3s %-20s %-12s %s\n", "", "PROFILE", "KUBECONFIG", "DIRECTORY")
+		for _, name := range listProfileNames() {
+			marker := ""
+			if name == current {
+				marker = "*"
+			}
+			dir, _ := profileDir(name)
+			status := "missing"
+			if kubeconfigEncrypted(name) {
+				status = "encrypted"
+			} else if _, err := os.Stat(filepath.Join(dir, kubeconfigFile)); err == nil {
+				status = "ok"
+			}
+			fmt.Printf("%-3s %-20s %-12s %s\n", marker, name, status, dir)
+		}
+	case "add", "create":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame profile add NAME [KUBECONFIG_FILE]")
+			return
+		}
+		name := os.Args[3]
+		kubeconfigSource := ""
+		if len(os.Args) > 4 {
+			kubeconfigSource = os.Args[4]
+		}
+		addProfile(name, kubeconfigSource)
+	case "use", "switch":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame profile use NAME")
+			return
+		}
+		useProfile(os.Args[3])
+	case "rm", "remove", "delete":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: hpcgame profile rm NAME")
+			return
+		}
+		removeProfile(os.Args[3])
+	case "set", "unset":
+		if (subCommand == "set" && len(os.Args) < 6) || len(os.Args) < 5 {
+			fmt.Printf("Usage: hpcgame profile %s NAME KEY", subCommand)
+			if subCommand == "set" {
+				fmt.Print(" VALUE")
+			}
+			fmt.Println()
+			return
+		}
+		setProfileConfig(os.Args[3], os.Args[4], os.Args[5:], subCommand == "unset")
+	case "current":
+		fmt.Println(currentProfile())
+	default:
+		fmt.Printf("Unknown profile subcommand: %s\n", subCommand)
+		printProfileHelp()
+	}
+}
+
+func addProfile(name string, kubeconfigSource string) {
+	if !profileNamePattern.MatchString(name) {
+		fmt.Printf("Invalid profile name: %s (use letters, digits, '-' and '_')\n", name)
+		return
+	}
+	if profileExists(name) {
+		fmt.Printf("Profile %s already exists\n", name)
+		return
+	}
+
+	var kubeconfig string
+	if kubeconfigSource != "" {
+		data, err := os.ReadFile(kubeconfigSource)
+		if err != nil {
+			fmt.Printf("Failed to read kubeconfig: %s\n", err)
+			return
+		}
+		kubeconfig = string(data)
+	} else {
+		kubeconfig = getKubeconfigFromUser()
+	}
+
+	if !validateKubeconfig(kubeconfig) {
+		fmt.Println("❌ Invalid kubeconfig provided. Please check and try again.")
+		return
+	}
+
+	dir, err := profileDir(name)
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		fmt.Printf("Failed to create profile directory: %s\n", err)
+		return
+	}
+
+	kubeconfigPath := filepath.Join(dir, kubeconfigFile)
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfig), 0600); err != nil {
+		fmt.Printf("Failed to save kubeconfig: %s\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Profile %s created with kubeconfig %s\n", name, kubeconfigPath)
+	fmt.Printf("Switch to it with: hpcgame profile use %s\n", name)
+}
+
+func useProfile(name string) {
+	if !profileExists(name) {
+		fmt.Printf("Profile %s does not exist. Use 'hpcgame profile ls' to list profiles\n", name)
+		return
+	}
+
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+	if err := os.MkdirAll(hpcgameDir, 0700); err != nil {
+		fmt.Printf("Failed to create directory: %s\n", err)
+		return
+	}
+
+	path := filepath.Join(hpcgameDir, currentProfileFile)
+	if name == defaultProfile {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(path, []byte(name+"\n"), 0600)
+	}
+	if err != nil {
+		fmt.Printf("Failed to switch profile: %s\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Now using profile %s\n", name)
+	if os.Getenv("HPCGAME_PROFILE") != "" {
+		fmt.Printf("⚠️ HPCGAME_PROFILE=%s is set and takes precedence in this shell\n", os.Getenv("HPCGAME_PROFILE"))
+	}
+}
+
+func removeProfile(name string) {
+	if name == defaultProfile {
+		fmt.Println("The default profile cannot be removed")
+		return
+	}
+	if !profileExists(name) {
+		fmt.Printf("Profile %s does not exist\n", name)
+		return
+	}
+	if !askYesNo(fmt.Sprintf("Remove profile %s and its kubeconfig?", name)) {
+		fmt.Println("Operation cancelled")
+		return
+	}
+
+	dir, err := profileDir(name)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		fmt.Printf("Failed to remove profile: %s\n", err)
+		return
+	}
+
+	// Fall back to the default profile if the removed one was selected
+	hpcgameDir, _ := hpcgameHome()
+	path := filepath.Join(hpcgameDir, currentProfileFile)
+	if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == name {
+		os.Remove(path)
+		fmt.Printf("Switched back to profile %s\n", defaultProfile)
+	}
+
+	fmt.Printf("✅ Profile %s removed\n", name)
+}
+
+// setProfileConfig changes a default stored in a profile's own config file
+func setProfileConfig(name string, key string, args []string, unset bool) {
+	if !profileExists(name) {
+		fmt.Printf("Profile %s does not exist\n", name)
+		return
+	}
+
+	path, err := profileConfigPath(name)
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+	if path == "" {
+		// The default profile uses the user config file
+		path, err = userConfigPath()
+		if err != nil {
+			fmt.Printf("Failed to get user home directory: %s\n", err)
+			return
+		}
+	}
+
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		fmt.Printf("Failed to read config: %s\n", err)
+		return
+	}
+	if unset {
+		err = cfg.unset(key)
+	} else {
+		err = cfg.set(key, args[0])
+	}
+	if err != nil {
+		fmt.Printf("Failed to update %s: %s\n", key, err)
+		return
+	}
+	if err := writeConfigFile(path, cfg); err != nil {
+		fmt.Printf("Failed to save config: %s\n", err)
+		return
+	}
+
+	fmt.Printf("✅ Profile %s updated (%s)\n", name, path)
+}
+
+func printProfileHelp() {
+	helpText := `Profile command usage:
+  hpcgame profile ls                          List profiles (* marks the active one)
+  hpcgame profile add NAME [KUBECONFIG_FILE]  Create a profile with its own kubeconfig
+  hpcgame profile use NAME                    Switch the active profile
+  hpcgame profile rm NAME                     Remove a profile
+  hpcgame profile set NAME KEY VALUE          Set a default for one profile
+  hpcgame profile unset NAME KEY              Remove a default from one profile
+  hpcgame profile current                     Print the active profile
+
+Examples:
+  hpcgame profile add team ./team-kubeconfig
+  hpcgame profile set team partition gpu
+  hpcgame profile set team partition_source https://example.com/partitions.json
+  hpcgame --profile team ps
+
+Note:
+  - The active profile can be overridden with --profile NAME or HPCGAME_PROFILE
+  - The 'default' profile uses ~/.hpcgame/kubeconfig and ~/.hpcgame/config.yaml
+  - Other profiles are stored in ~/.hpcgame/profiles/NAME
+`
+	fmt.Println(helpText)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const progressInterval = 200 * time.Millisecond
+
+// transferProgress counts the bytes of a transfer and draws a progress bar on
+// stderr while it runs. Writes are counted, so it can sit behind an
+// io.TeeReader or io.MultiWriter.
+type transferProgress struct {
+	total   int64 // 0 if unknown
+	done    atomic.Int64
+	resumed atomic.Int64 // bytes transferred by an earlier, interrupted run
+	wire    atomic.Int64 // bytes sent or received after compression
+	start   time.Time
+	show    bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newTransferProgress(total int64, quiet bool) *transferProgress {
+	p := &transferProgress{
+		total: total,
+		start: time.Now(),
+		show:  !quiet && term.IsTerminal(int(os.Stderr.Fd())),
+		stop:  make(chan struct{}),
+	}
+	if p.show {
+		p.wg.Add(1)
+		go p.draw()
+	}
+	return p
+}
+
+func (p *transferProgress) Write(b []byte) (int, error) {
+	p.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// resumeAt moves the progress to offset, which was already transferred
+// before, without counting it into the rate
+func (p *transferProgress) resumeAt(offset int64) {
+	p.resumed.Store(offset)
+	p.done.Store(offset)
+}
+
+// wireCounter counts the compressed bytes of the transfer
+type wireCounter struct {
+	p *transferProgress
+}
+
+func (w wireCounter) Write(b []byte) (int, error) {
+	w.p.wire.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *transferProgress) draw() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			// Clear the line for the summary
+			fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", p.width()))
+			return
+		case <-ticker.C:
+			fmt.Fprintf(os.Stderr, "\r%s", p.line())
+		}
+	}
+}
+
+func (p *transferProgress) width() int {
+	if width, _, err := term.GetSize(int(os.Stderr.Fd())); err == nil && width > 0 {
+		return width - 1
+	}
+	return 79
+}
+
+// line renders "  45% [=====>    ] 1.2 GiB / 2.7 GiB  35.2 MiB/s  ETA 0:42"
+func (p *transferProgress) line() string {
+	done := p.done.Load()
+	elapsed := time.Since(p.start)
+	rate := float64(done-p.resumed.Load()) / elapsed.Seconds()
+	stats := fmt.Sprintf("%s  %s/s", formatBytes(done), formatBytes(int64(rate)))
+
+	if p.total <= 0 {
+		return fitLine(stats, p.width())
+	}
+	fraction := float64(done) / float64(p.total)
+	if fraction > 1 {
+		fraction = 1
+	}
+	stats = fmt.Sprintf("%s / %s  %s/s", formatBytes(done), formatBytes(p.total), formatBytes(int64(rate)))
+	if rate > 0 && done < p.total {
+		stats += "  ETA " + formatETA(time.Duration(float64(p.total-done)/rate*float64(time.Second)))
+	}
+
+	barWidth := p.width() - len(stats) - 9
+	if barWidth > 40 {
+		barWidth = 40
+	}
+	if barWidth < 10 {
+		return fitLine(fmt.Sprintf("%3.0f%% %s", fraction*100, stats), p.width())
+	}
+	filled := int(fraction * float64(barWidth))
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	return fmt.Sprintf("%3.0f%% [%s] %s", fraction*100, bar, stats)
+}
+
+func fitLine(s string, width int) string {
+	if len(s) > width {
+		return s[:width]
+	}
+	return s
+}
+
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d >= time.Hour {
+		return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// finish stops the progress bar and returns the summary of the transfer
+func (p *transferProgress) finish() string {
+	if p.show {
+		close(p.stop)
+		p.wg.Wait()
+	}
+	done := p.done.Load() - p.resumed.Load()
+	elapsed := time.Since(p.start)
+	shown := elapsed.Round(100 * time.Millisecond)
+	if elapsed < time.Second {
+		shown = elapsed.Round(time.Millisecond)
+	}
+	summary := fmt.Sprintf("%s in %s (%s/s", formatBytes(done), shown, formatBytes(int64(float64(done)/elapsed.Seconds())))
+	if wire := p.wire.Load(); wire > 0 && wire != done {
+		summary += fmt.Sprintf(", %s over the wire", formatBytes(wire))
+	}
+	return summary + ")"
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const projectFileName = ".hpcgame.yaml"
+
+// ProjectConfig is the per-project .hpcgame.yaml found from the working directory
+type ProjectConfig struct {
+	Container struct {
+		Name      string `yaml:"name"`
+		Partition string `yaml:"partition"`
+		Image     string `yaml:"image"`
+		CPU       int    `yaml:"cpu"`
+		Memory    int    `yaml:"memory"`
+		GPU       int    `yaml:"gpu"`
+	} `yaml:"container"`
+	Volumes []string        `yaml:"volumes"`
+	Sync    []SyncRule      `yaml:"sync"`
+	Tasks   map[string]Task `yaml:"tasks"`
+
+	// Path is the location of the project file, Dir its directory
+	Path string `yaml:"-"`
+	Dir  string `yaml:"-"`
+}
+
+// SyncRule maps a local directory of the project to a path inside the container
+type SyncRule struct {
+	Local   string   `yaml:"local"`
+	Remote  string   `yaml:"remote"`
+	Exclude []string `yaml:"exclude"`
+	Delete  bool     `yaml:"delete"`
+}
+
+// Task is a named command run inside the project's container
+type Task struct {
+	Description string `yaml:"description"`
+	Command     string `yaml:"command"`
+	Workdir     string `yaml:"workdir"`
+	Container   string `yaml:"container"`
+}
+
+// UnmarshalYAML allows a task to be written as a bare command string
+func (t *Task) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		t.Command = command
+		return nil
+	}
+
+	type plainTask Task
+	return unmarshal((*plainTask)(t))
+}
+
+var (
+	cachedProject       *ProjectConfig
+	cachedProjectLoaded bool
+)
+
+// findProjectFile walks up from the working directory looking for .hpcgame.yaml
+func findProjectFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, projectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProject returns the project config, or nil if there is none or it cannot be parsed
+func loadProject() *ProjectConfig {
+	if cachedProjectLoaded {
+		return cachedProject
+	}
+	cachedProjectLoaded = true
+
+	path := findProjectFile()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to read project file %s: %s\n", path, err)
+		return nil
+	}
+
+	project := &ProjectConfig{}
+	if err := yaml.Unmarshal(data, project); err != nil {
+		fmt.Printf("⚠️ Ignoring project file %s: %s\n", path, err)
+		return nil
+	}
+	project.Path = path
+	project.Dir = filepath.Dir(path)
+
+	// Local sync paths are relative to the project file
+	for i, rule := range project.Sync {
+		if rule.Local != "" && !filepath.IsAbs(rule.Local) {
+			project.Sync[i].Local = filepath.Join(project.Dir, rule.Local)
+		}
+	}
+
+	cachedProject = project
+	return project
+}
+
+// values flattens the container spec into the same keys as the user config
+func (p *ProjectConfig) values() map[string]string {
+	values := map[string]string{}
+	if p.Container.Name != "" {
+		values["name"] = p.Container.Name
+	}
+	if p.Container.Partition != "" {
+		values["partition"] = p.Container.Partition
+	}
+	if p.Container.Image != "" {
+		values["image"] = p.Container.Image
+	}
+	if p.Container.CPU > 0 {
+		values["cpu"] = strconv.Itoa(p.Container.CPU)
+	}
+	if p.Container.Memory > 0 {
+		values["memory"] = strconv.Itoa(p.Container.Memory)
+	}
+	if p.Container.GPU > 0 {
+		values["gpu"] = strconv.Itoa(p.Container.GPU)
+	}
+	if len(p.Volumes) > 0 {
+		values["volumes"] = strings.Join(p.Volumes, ",")
+	}
+	return values
+}
+
+func (p *ProjectConfig) taskNames() []string {
+	names := make([]string, 0, len(p.Tasks))
+	for name := range p.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func handleTaskCommands() {
+	project := loadProject()
+	if project == nil || len(project.Tasks) == 0 {
+		fmt.Printf("No tasks defined. Add a 'tasks' section to %s in your project directory\n", projectFileName)
+		return
+	}
+
+	if len(os.Args) < 3 || os.Args[2] == "ls" || os.Args[2] == "list" {
+		fmt.Printf("Tasks defined in %s:\n", project.Path)
+		for _, name := range project.taskNames() {
+			task := project.Tasks[name]
+			description := task.Description
+			if description == "" {
+				description = task.Command
+			}
+			fmt.Printf("  %-15s %s\n", name, description)
+		}
+		fmt.Println("\nUsage: hpcgame task run NAME [CONTAINER]")
+		return
+	}
+
+	if os.Args[2] != "run" || len(os.Args) < 4 {
+		fmt.Println("Usage: hpcgame task run NAME [CONTAINER]")
+		return
+	}
+
+	name := os.Args[3]
+	task, ok := project.Tasks[name]
+	if !ok {
+		fmt.Printf("Unknown task: %s\n", name)
+		return
+	}
+
+	containerName := task.Container
+	if len(os.Args) > 4 {
+		containerName = os.Args[4]
+	}
+	if containerName == "" {
+		containerName = loadSettings().String("name")
+	}
+	if containerName == "" {
+		fmt.Println("Container name required")
+		fmt.Println("Usage: hpcgame task run NAME CONTAINER")
+		fmt.Printf("Or set 'container.name' in %s\n", project.Path)
+		return
+	}
+
+	runTask(containerName, name, task)
+}
+
+func runTask(containerName string, name string, task Task) {
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+
+	script := task.Command
+	if task.Workdir != "" {
+		script = fmt.Sprintf("cd %s && %s", shellQuote(task.Workdir), task.Command)
+	}
+
+	fmt.Printf("Running task %s in container %s: %s\n", name, containerName, task.Command)
+
+	cmd := kubectlCommand(kubeconfigPath, "exec", "-i", containerName, "--", "sh", "-c", script)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Task %s failed: %s\n", name, err)
+		return
+	}
+
+	fmt.Printf("✅ Task %s finished\n", name)
+}
+
+// shellQuote quotes a string for use in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
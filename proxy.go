@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSocksPort = "1080"
+
+	// proxyTunnelIdle is how long an unused port-forward is kept for the
+	// next connection to the same target
+	proxyTunnelIdle = time.Minute
+
+	// proxyListingTTL is how long the list of pods and services is cached
+	// for resolving names
+	proxyListingTTL = 15 * time.Second
+
+	proxyConnectTimeout = 30 * time.Second
+)
+
+// proxyTarget is a pod or service that connections are forwarded to
+type proxyTarget struct {
+	namespace string
+	resource  string // pod/NAME or service/NAME
+}
+
+func (t proxyTarget) String() string {
+	return t.namespace + "/" + t.resource
+}
+
+// proxyTunnel is a port-forward to one port of a target, shared by all
+// connections to it
+type proxyTunnel struct {
+	local  string // the local port, once forwarding
+	err    error
+	ready  chan struct{}
+	stop   chan struct{}
+	active int
+	idle   time.Time
+}
+
+// clusterProxy resolves host names to pods and services and connects to them
+// through port-forwards
+type clusterProxy struct {
+	kubeconfig string
+	namespace  string
+	quiet      bool // do not announce new tunnels
+
+	mu      sync.Mutex
+	tunnels map[string]*proxyTunnel
+	running sync.WaitGroup
+
+	listingLock sync.Mutex
+	listed      time.Time
+	pods        map[string]string // name and IP to name
+	services    map[string]string
+}
+
+func newClusterProxy(kubeconfigPath string) *clusterProxy {
+	return &clusterProxy{
+		kubeconfig: kubeconfigPath,
+		namespace:  resolveNamespace(kubeconfigPath),
+		tunnels:    map[string]*proxyTunnel{},
+	}
+}
+
+// refreshListing loads the pods and services of the namespace, at most once
+// per proxyListingTTL
+func (p *clusterProxy) refreshListing() error {
+	p.listingLock.Lock()
+	defer p.listingLock.Unlock()
+	if time.Since(p.listed) < proxyListingTTL {
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := kubectlCommand(p.kubeconfig, "get", "pods,services", "-o", "json")
+	cmd.Stderr = watchCredentials(&stderr)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list containers and services: %s", strings.TrimSpace(stderr.String()))
+	}
+	var list struct {
+		Items []struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				ClusterIP string `json:"clusterIP"`
+			} `json:"spec"`
+			Status struct {
+				PodIP string `json:"podIP"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return fmt.Errorf("failed to parse container list: %s", err)
+	}
+
+	p.pods, p.services = map[string]string{}, map[string]string{}
+	for _, item := range list.Items {
+		name := item.Metadata.Name
+		switch item.Kind {
+		case "Pod":
+			p.pods[name] = name
+			if item.Status.PodIP != "" {
+				p.pods[item.Status.PodIP] = name
+			}
+		case "Service":
+			p.services[name] = name
+			if item.Spec.ClusterIP != "" && item.Spec.ClusterIP != "None" {
+				p.services[item.Spec.ClusterIP] = name
+			}
+		}
+	}
+	p.listed = time.Now()
+	return nil
+}
+
+// resolve maps a host name to a target: a container name or IP, a service
+// name or IP, or service DNS names such as NAME.NAMESPACE.svc.cluster.local
+func (p *clusterProxy) resolve(host string) (proxyTarget, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	name := strings.TrimSuffix(strings.TrimSuffix(host, ".cluster.local"), ".svc")
+	if net.ParseIP(host) == nil && strings.Count(name, ".") == 1 {
+		service, namespace, _ := strings.Cut(name, ".")
+		return proxyTarget{namespace: namespace, resource: "service/" + service}, nil
+	}
+
+	if err := p.refreshListing(); err != nil {
+		return proxyTarget{}, err
+	}
+	p.listingLock.Lock()
+	defer p.listingLock.Unlock()
+	if pod, ok := p.pods[name]; ok {
+		return proxyTarget{namespace: p.namespace, resource: "pod/" + pod}, nil
+	}
+	if service, ok := p.services[name]; ok {
+		return proxyTarget{namespace: p.namespace, resource: "service/" + service}, nil
+	}
+	return proxyTarget{}, fmt.Errorf("%s is not a container or service in namespace %s", host, p.namespace)
+}
+
+// tunnel returns the port-forward to port of target, starting it if needed.
+// release must be called when the connection through it is closed.
+func (p *clusterProxy) tunnel(target proxyTarget, port string) (string, func(), error) {
+	key := target.String() + ":" + port
+	p.mu.Lock()
+	t := p.tunnels[key]
+	if t == nil {
+		t = &proxyTunnel{ready: make(chan struct{}), stop: make(chan struct{})}
+		p.tunnels[key] = t
+		p.running.Add(1)
+		go p.runTunnel(key, t, target, port)
+	}
+	t.active++
+	p.mu.Unlock()
+
+	release := func() {
+		p.mu.Lock()
+		t.active--
+		t.idle = time.Now()
+		p.mu.Unlock()
+	}
+	select {
+	case <-t.ready:
+	case <-time.After(proxyConnectTimeout):
+		release()
+		return "", nil, fmt.Errorf("timed out forwarding to %s:%s", target.resource, port)
+	}
+	p.mu.Lock()
+	local := t.local
+	p.mu.Unlock()
+	if local == "" {
+		release()
+		return "", nil, t.err
+	}
+	return local, release, nil
+}
+
+func (p *clusterProxy) runTunnel(key string, t *proxyTunnel, target proxyTarget, port string) {
+	defer p.running.Done()
+	f := &portForwarder{
+		kubeconfig: p.kubeconfig,
+		target:     target.resource,
+		namespace:  target.namespace,
+		address:    "127.0.0.1",
+		mappings:   []portMapping{{remote: port}},
+	}
+	var readyOnce sync.Once
+	f.changed = func() {
+		f.mu.Lock()
+		local := f.mappings[0].local
+		f.mu.Unlock()
+		if local != "" {
+			readyOnce.Do(func() {
+				p.mu.Lock()
+				t.local = local
+				p.mu.Unlock()
+				close(t.ready)
+			})
+		}
+	}
+	if !p.quiet {
+		fmt.Printf("Forwarding to %s:%s\n", strings.TrimPrefix(target.resource, "pod/"), port)
+	}
+
+	_, err := f.run(io.Discard, t.stop)
+	if err == nil {
+		err = fmt.Errorf("port forwarding to %s:%s ended", target.resource, port)
+	}
+	p.mu.Lock()
+	if p.tunnels[key] == t {
+		delete(p.tunnels, key)
+	}
+	p.mu.Unlock()
+	readyOnce.Do(func() {
+		t.err = err
+		close(t.ready)
+	})
+}
+
+// closeIdleTunnels stops the port-forwards that have not been used for a while
+func (p *clusterProxy) closeIdleTunnels() {
+	for range time.Tick(10 * time.Second) {
+		p.mu.Lock()
+		for key, t := range p.tunnels {
+			if t.active == 0 && t.local != "" && time.Since(t.idle) > proxyTunnelIdle {
+				close(t.stop)
+				delete(p.tunnels, key)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// close stops all port-forwards and waits for kubectl to exit
+func (p *clusterProxy) close() {
+	p.mu.Lock()
+	for key, t := range p.tunnels {
+		close(t.stop)
+		delete(p.tunnels, key)
+	}
+	p.mu.Unlock()
+	p.running.Wait()
+}
+
+// proxyConn releases its tunnel when closed
+type proxyConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *proxyConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// dial connects to host:port in the cluster
+func (p *clusterProxy) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	target, err := p.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	local, release, err := p.tunnel(target, port)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, release: release}, nil
+}
+
+// pipe copies between two connections until both directions are done
+func pipe(a net.Conn, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst net.Conn, src net.Conn) {
+		io.Copy(dst, src)
+		if tcp, ok := dst.(interface{ CloseWrite() error }); ok {
+			tcp.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	<-done
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// SOCKS5 (RFC 1928) reply codes
+const (
+	socksSucceeded          = 0x00
+	socksGeneralFailure     = 0x01
+	socksHostUnreachable    = 0x04
+	socksCommandUnsupported = 0x07
+	socksAddressUnsupported = 0x08
+)
+
+// serveSocks handles a SOCKS5 connection without authentication. Only
+// CONNECT is supported.
+func (p *clusterProxy) serveSocks(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(proxyConnectTimeout))
+	r := bufio.NewReader(conn)
+
+	reply := func(code byte) {
+		conn.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+	}
+
+	// Greeting: version, then the offered authentication methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil || header[0] != 5 {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+	if bytes.IndexByte(methods, 0) < 0 {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: version, command, reserved, address type, address, port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil || request[0] != 5 {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1, 4:
+		ip := make(net.IP, 4)
+		if request[3] == 4 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return
+		}
+		host = ip.String()
+	case 3:
+		length, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		reply(socksAddressUnsupported)
+		return
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, portBytes); err != nil {
+		return
+	}
+	if request[1] != 1 {
+		reply(socksCommandUnsupported)
+		return
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	upstream, err := p.dial(context.Background(), "tcp", address)
+	if err != nil {
+		fmt.Printf("⚠️ %s: %s\n", address, err)
+		if strings.Contains(err.Error(), "is not a container or service") {
+			reply(socksHostUnreachable)
+		} else {
+			reply(socksGeneralFailure)
+		}
+		return
+	}
+	reply(socksSucceeded)
+	conn.SetDeadline(time.Time{})
+
+	// Data the client sent after the request is still buffered
+	if r.Buffered() > 0 {
+		buffered, _ := r.Peek(r.Buffered())
+		upstream.Write(buffered)
+	}
+	pipe(conn, upstream)
+}
+
+// httpHandler serves CONNECT requests and plain HTTP requests with absolute
+// URLs, as browsers send them to an HTTP proxy
+func (p *clusterProxy) httpHandler() http.Handler {
+	reverse := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {},
+		Transport: &http.Transport{
+			DialContext:     p.dial,
+			IdleConnTimeout: proxyTunnelIdle,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("⚠️ %s: %s\n", r.Host, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			if !r.URL.IsAbs() {
+				http.Error(w, "this is a proxy, requests need an absolute URL", http.StatusBadRequest)
+				return
+			}
+			reverse.ServeHTTP(w, r)
+			return
+		}
+
+		upstream, err := p.dial(r.Context(), "tcp", r.Host)
+		if err != nil {
+			fmt.Printf("⚠️ %s: %s\n", r.Host, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			upstream.Close()
+			http.Error(w, "connection cannot be taken over", http.StatusInternalServerError)
+			return
+		}
+		conn, buffered, err := hijacker.Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		if buffered.Reader.Buffered() > 0 {
+			data, _ := buffered.Reader.Peek(buffered.Reader.Buffered())
+			upstream.Write(data)
+		}
+		pipe(conn, upstream)
+	})
+}
+
+// listenAddress turns PORT or HOST:PORT into an address, on localhost unless
+// a host is given
+func listenAddress(value string) string {
+	if _, err := strconv.Atoi(value); err == nil {
+		return net.JoinHostPort("127.0.0.1", value)
+	}
+	return value
+}
+
+// warnIfExposed points out a proxy that other machines can use: it has no
+// authentication and reaches everything in the namespace
+func warnIfExposed(listener net.Listener, kind string) {
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		fmt.Printf("⚠️ The %s proxy listens on %s and has no authentication, anyone on the network can reach the cluster through it\n", kind, addr)
+	}
+}
+
+func printProxyHelp() {
+	fmt.Println("Usage: hpcgame proxy [--socks [HOST:]PORT] [--http [HOST:]PORT]")
+	fmt.Println("Runs a local proxy into the cluster network. Host names are resolved to")
+	fmt.Println("containers and services of the namespace, by name or IP; service DNS names")
+	fmt.Println("such as NAME.NAMESPACE.svc.cluster.local are also accepted. Each connection")
+	fmt.Println("is tunnelled through a port-forward to the target.")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  hpcgame proxy --socks 1080")
+	fmt.Println("  curl --socks5-hostname localhost:1080 http://my-container:8888/")
+	fmt.Println("  hpcgame proxy --socks 1080 --http 8080")
+	fmt.Println("  curl --proxy http://localhost:8080 http://my-container:8888/")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Printf("  --socks [HOST:]PORT  Run a SOCKS5 proxy (default %s if --http is not given)\n", defaultSocksPort)
+	fmt.Println("  --http [HOST:]PORT   Run an HTTP proxy, supporting CONNECT")
+	fmt.Println()
+	fmt.Println("In a browser, use a SOCKS v5 proxy with remote DNS (\"Proxy DNS when using")
+	fmt.Println("SOCKS v5\" in Firefox) so that container names are resolved by the proxy.")
+}
+
+func runProxy() {
+	proxyCmd := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	socks := proxyCmd.String("socks", "", "Run a SOCKS5 proxy on [HOST:]PORT")
+	httpAddress := proxyCmd.String("http", "", "Run an HTTP proxy on [HOST:]PORT")
+	proxyCmd.Usage = printProxyHelp
+	if args := parseInterspersed(proxyCmd, os.Args[2:]); len(args) > 0 {
+		fmt.Printf("Unexpected argument: %s\n", args[0])
+		printProxyHelp()
+		exit(exitUsage)
+	}
+	if *socks == "" && *httpAddress == "" {
+		*socks = defaultSocksPort
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+	proxy := newClusterProxy(kubeconfigPath)
+	if err := proxy.refreshListing(); err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	go proxy.closeIdleTunnels()
+
+	failed := make(chan error, 2)
+	if *socks != "" {
+		listener, err := net.Listen("tcp", listenAddress(*socks))
+		if err != nil {
+			fmt.Printf("❌ Cannot start the SOCKS5 proxy: %s\n", err)
+			exit(exitFailure)
+		}
+		fmt.Printf("✅ SOCKS5 proxy listening on %s\n", listener.Addr())
+		warnIfExposed(listener, "SOCKS5")
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					failed <- err
+					return
+				}
+				go proxy.serveSocks(conn)
+			}
+		}()
+	}
+	if *httpAddress != "" {
+		listener, err := net.Listen("tcp", listenAddress(*httpAddress))
+		if err != nil {
+			fmt.Printf("❌ Cannot start the HTTP proxy: %s\n", err)
+			exit(exitFailure)
+		}
+		fmt.Printf("✅ HTTP proxy listening on %s\n", listener.Addr())
+		warnIfExposed(listener, "HTTP")
+		go func() {
+			failed <- http.Serve(listener, proxy.httpHandler())
+		}()
+	}
+	fmt.Printf("Containers and services in namespace %s are reachable by name, press Ctrl+C to stop\n", proxy.namespace)
+
+	err := <-failed
+	fmt.Printf("❌ Proxy failed: %s\n", err)
+	exit(exitFailure)
+}
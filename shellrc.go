@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	rcBlockStart = "# >>> hpcgame >>>"
+	rcBlockEnd   = "# <<< hpcgame <<<"
+)
+
+var supportedShells = []string{"bash", "zsh", "fish"}
+
+// shellRCPath returns the startup file hpcgame edits for a shell
+func shellRCPath(shell string) string {
+	home := os.Getenv("HOME")
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".bashrc")
+	case "zsh":
+		return filepath.Join(home, ".zshrc")
+	case "fish":
+		return filepath.Join(home, ".config", "fish", "config.fish")
+	}
+	return ""
+}
+
+// detectShell returns the user's login shell if it is supported
+func detectShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range supportedShells {
+		if shell == s {
+			return s
+		}
+	}
+	return ""
+}
+
+// pathSnippet returns shell code that appends dir to PATH only once
+func pathSnippet(shell string, dir string) string {
+	if shell == "fish" {
+		return fmt.Sprintf("contains -- %s $PATH; or set -gx PATH $PATH %s\n", fishQuote(dir), fishQuote(dir))
+	}
+	return fmt.Sprintf("case \":$PATH:\" in *\":%s:\"*) ;; *) export PATH=\"$PATH:%s\" ;; esac\n", dir, dir)
+}
+
+func envSnippet(shell string, name string, value string) string {
+	if shell == "fish" {
+		return fmt.Sprintf("set -gx %s %s\n", name, fishQuote(value))
+	}
+	return fmt.Sprintf("export %s=%s\n", name, shellQuote(value))
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
+
+// writeRCBlock puts content between the hpcgame markers in an rc file,
+// replacing a previous block instead of appending another one
+func writeRCBlock(path string, content string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	block := rcBlockStart + "\n" + content + rcBlockEnd + "\n"
+	text := removeRCBlockText(string(data))
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	if text != "" {
+		text += "\n"
+	}
+	text += block
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(text), mode)
+}
+
+// removeRCBlockText strips the hpcgame block and the blank line before it
+func removeRCBlockText(text string) string {
+	start := strings.Index(text, rcBlockStart)
+	if start < 0 {
+		return text
+	}
+	end := strings.Index(text[start:], rcBlockEnd)
+	if end < 0 {
+		return text
+	}
+	end += start + len(rcBlockEnd)
+	if end < len(text) && text[end] == '\n' {
+		end++
+	}
+	before := strings.TrimSuffix(text[:start], "\n")
+	if text[end:] == "" {
+		before = strings.TrimRight(before, "\n")
+		if before != "" {
+			before += "\n"
+		}
+	} else {
+		before += "\n"
+	}
+	return before + text[end:]
+}
+
+func removeRCBlock(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(removeRCBlockText(string(data))), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return removeBlankRC(path)
+}
+
+// removeBlankRC deletes an rc file that holds nothing but whitespace, such
+// as one install created for the hpcgame block alone
+func removeBlankRC(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != "" {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// isShellRC reports whether path is the rc file of a supported shell
+func isShellRC(path string) bool {
+	for _, shell := range supportedShells {
+		if shellRCPath(shell) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// addToShellPath offers to add dir to PATH in the rc files of bash, zsh and
+// fish, using a marked block that later installs replace
+func addToShellPath(installPath string, opts installOptions) {
+	if runtime.GOOS == "windows" {
+		fmt.Printf("Please add %s to your PATH\n", installPath)
+		return
+	}
+
+	// Edit the rc files that exist, plus the one of the login shell
+	loginShell := detectShell()
+	var shells []string
+	for _, shell := range supportedShells {
+		if _, err := os.Stat(shellRCPath(shell)); err == nil || shell == loginShell {
+			shells = append(shells, shell)
+		}
+	}
+	if len(shells) == 0 {
+		fmt.Printf("Please add %s to your PATH, or add 'eval \"$(hpcgame shell-init)\"' to your shell startup file\n", installPath)
+		return
+	}
+
+	var rcNames []string
+	for _, shell := range shells {
+		rcNames = append(rcNames, filepath.Base(shellRCPath(shell)))
+	}
+
+	addToPath := !opts.NoModifyRC
+	if addToPath && !opts.Yes {
+		fmt.Printf("Would you like to add %s to PATH by modifying %s? (Y/n): ", installPath, strings.Join(rcNames, ", "))
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		answer := scanner.Text()
+		addToPath = answer == "Y" || answer == "y" || answer == ""
+	}
+	if !addToPath {
+		fmt.Printf("Please manually add %s to your PATH, or run 'hpcgame shell-init' to print the snippet\n", installPath)
+		return
+	}
+
+	legacyLine := fmt.Sprintf("\nexport PATH=$PATH:%s\n", installPath)
+	for _, shell := range shells {
+		rcPath := shellRCPath(shell)
+		// Drop the lines older versions appended on every install
+		if data, err := os.ReadFile(rcPath); err == nil {
+			for i := strings.Count(string(data), legacyLine); i > 0; i-- {
+				removeRCText(rcPath, legacyLine)
+			}
+		}
+		if err := writeRCBlock(rcPath, pathSnippet(shell, installPath)); err != nil {
+			fmt.Printf("Failed to write to %s: %s\n", rcPath, err)
+			continue
+		}
+		recordArtifact(manifestEntry{Kind: artifactRCBlock, Path: rcPath})
+		fmt.Printf("Added %s to PATH in %s\n", installPath, rcPath)
+	}
+}
+
+// shellInitScript returns the snippet printed by 'hpcgame shell-init'
+func shellInitScript(shell string) string {
+	var script strings.Builder
+	script.WriteString("# hpcgame shell integration\n")
+
+	if hpcgameDir, err := hpcgameHome(); err == nil {
+		script.WriteString(pathSnippet(shell, filepath.Join(hpcgameDir, "bin")))
+	}
+	if version := currentManagedKubectl(); version != "" {
+		script.WriteString(pathSnippet(shell, filepath.Dir(managedKubectlPath(version))))
+	}
+	if kubeconfigEncrypted(currentProfile()) {
+		script.WriteString("# The kubeconfig is encrypted, KUBECONFIG is only available to hpcgame commands\n")
+	} else if dir, err := profileDir(currentProfile()); err == nil {
+		script.WriteString(envSnippet(shell, "KUBECONFIG", filepath.Join(dir, kubeconfigFile)))
+	}
+	script.WriteString(completionScript(shell))
+	return script.String()
+}
+
+func shellInit() {
+	shell := detectShell()
+	if len(os.Args) > 2 {
+		shell = os.Args[2]
+	}
+
+	supported := false
+	for _, s := range supportedShells {
+		if shell == s {
+			supported = true
+		}
+	}
+	if !supported {
+		fmt.Fprintln(os.Stderr, "Usage: hpcgame shell-init bash|zsh|fish")
+		fmt.Fprintln(os.Stderr, "Add the output to your shell startup file, e.g.:")
+		fmt.Fprintln(os.Stderr, "  bash/zsh: eval \"$(hpcgame shell-init bash)\"")
+		fmt.Fprintln(os.Stderr, "  fish:     hpcgame shell-init fish | source")
+		exit(exitUsage)
+	}
+
+	fmt.Print(shellInitScript(shell))
+}
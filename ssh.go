@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshDir         = "ssh"
+	sshKeyFile     = "id_ed25519"
+	sshHostKeyFile = "host_key"
+	sshConfigFile  = "ssh_config"
+
+	// sshNoServer is printed by sshServerScript when the container has no SSH
+	// server that could be started
+	sshNoServer = "HPCGAME-NO-SSH-SERVER"
+)
+
+// sshKeyPath returns where the key ssh uses to log in to containers is kept.
+// It is shared by all profiles.
+func sshKeyPath(name string) (string, error) {
+	dir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sshDir, name), nil
+}
+
+// loadOrCreateKey reads an ed25519 key in OpenSSH format, generating it with
+// a .pub file next to it if it does not exist yet
+func loadOrCreateKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(private, "hpcgame")
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	public := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " hpcgame\n"
+	if err := writeFileAtomic(path+".pub", []byte(public), 0644); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// sshServerScript prepares the container for key authentication and runs
+// dropbear or sshd on stdin/stdout. Host keys are kept in ~/.ssh/hpcgame, so
+// they survive as long as the home directory does. If no server can be
+// started, sshNoServer is printed instead of an SSH banner.
+func sshServerScript(authorizedKey string) string {
+	return `umask 077
+key=` + shellQuote(authorizedKey) + `
+d="$HOME/.ssh/hpcgame"
+mkdir -p "$d" 2>/dev/null && { grep -qxF "$key" "$HOME/.ssh/authorized_keys" 2>/dev/null || echo "$key" >> "$HOME/.ssh/authorized_keys"; } 2>/dev/null || {
+	echo ` + sshNoServer + `; exit 0
+}
+if command -v dropbear >/dev/null 2>&1; then
+	[ -f "$d/dropbear_host_key" ] || dropbearkey -t ed25519 -f "$d/dropbear_host_key" >/dev/null 2>&1 || dropbearkey -t ecdsa -f "$d/dropbear_host_key" >/dev/null 2>&1
+	[ -f "$d/dropbear_host_key" ] && { dropbear -i -s -r "$d/dropbear_host_key" 2>>"$d/server.log" || echo ` + sshNoServer + `; exit 0; }
+fi
+sshd=$(command -v sshd 2>/dev/null || ls /usr/sbin/sshd 2>/dev/null)
+if [ -n "$sshd" ]; then
+	[ -f "$d/ssh_host_ed25519_key" ] || ssh-keygen -q -t ed25519 -N '' -f "$d/ssh_host_ed25519_key" >/dev/null 2>&1
+	if [ -f "$d/ssh_host_ed25519_key" ]; then
+		mkdir -p /run/sshd 2>/dev/null
+		"$sshd" -i -f /dev/null -h "$d/ssh_host_ed25519_key" -o PidFile=none \
+			-o AuthorizedKeysFile=.ssh/authorized_keys -o PasswordAuthentication=no \
+			-o "Subsystem sftp internal-sftp" 2>>"$d/server.log" || echo ` + sshNoServer + `
+		exit 0
+	fi
+fi
+echo ` + sshNoServer
+}
+
+// stdioConn is the connection to the ssh client of a ProxyCommand
+type stdioConn struct {
+	io.Reader
+	io.Writer
+}
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
+
+func (c stdioConn) Close() error                       { return nil }
+func (c stdioConn) LocalAddr() net.Addr                { return stdioAddr{} }
+func (c stdioConn) RemoteAddr() net.Addr               { return stdioAddr{} }
+func (c stdioConn) SetDeadline(t time.Time) error      { return nil }
+func (c stdioConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c stdioConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// relayedStderr keeps kubectl's stderr until the server answered, for the
+// error message, and passes it on to the ssh client afterwards
+type relayedStderr struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	connected bool
+}
+
+func (r *relayedStderr) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.connected {
+		return os.Stderr.Write(p)
+	}
+	return r.buf.Write(p)
+}
+
+func (r *relayedStderr) connect() {
+	r.mu.Lock()
+	r.connected = true
+	r.mu.Unlock()
+}
+
+func (r *relayedStderr) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.String()
+}
+
+// sshSession is a session channel served with kubectl exec
+type sshSession struct {
+	kubeconfig string
+	container  string
+	channel    ssh.Channel
+	env        []string
+	term       string
+	rows       uint32
+	cols       uint32
+	pty        bool
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sftpServerScript runs the sftp-server of the container, for scp and sftp
+const sftpServerScript = `for s in "$(command -v sftp-server 2>/dev/null)" /usr/lib/openssh/sftp-server /usr/libexec/openssh/sftp-server /usr/lib/ssh/sftp-server /usr/libexec/sftp-server /usr/lib/sftp-server; do
+	[ -n "$s" ] && [ -x "$s" ] && exec "$s"
+done
+echo "sftp-server not found in the container, use scp -O or rsync instead" >&2
+exit 127`
+
+// script returns the shell script running command, or a login shell if it
+// is empty, the way sshd would: in the home directory, with the variables
+// the client sent and, if requested, a terminal
+func (s *sshSession) script(command string) string {
+	var b strings.Builder
+	b.WriteString(`cd "$HOME" 2>/dev/null; `)
+	for _, variable := range s.env {
+		name, value, _ := strings.Cut(variable, "=")
+		fmt.Fprintf(&b, "export %s=%s; ", name, shellQuote(value))
+	}
+	if command == "" {
+		command = `exec "${SHELL:-/bin/sh}" -l`
+	}
+	if !s.pty {
+		return b.String() + command
+	}
+
+	// kubectl exec cannot allocate a terminal without one on this side, so
+	// script(1) provides it in the container when available
+	fmt.Fprintf(&b, "export TERM=%s; ", shellQuote(s.term))
+	inner := command
+	if s.rows > 0 && s.cols > 0 {
+		inner = fmt.Sprintf("stty rows %d cols %d 2>/dev/null; %s", s.rows, s.cols, command)
+	}
+	fmt.Fprintf(&b, `if command -v script >/dev/null 2>&1; then exec script -q -c %s /dev/null; fi; `, shellQuote(inner))
+	b.WriteString(`echo "No terminal available in the container (script is missing)" >&2; `)
+	return b.String() + command
+}
+
+// run executes a script with the channel as its standard streams and
+// returns its exit status
+func (s *sshSession) run(script string) uint32 {
+	cmd := kubectlCommand(s.kubeconfig, "exec", "-i", s.container, "--", "sh", "-c", script)
+	cmd.Stdout = s.channel
+	cmd.Stderr = s.channel.Stderr()
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fmt.Fprintf(s.channel.Stderr(), "❌ %s\n", err)
+		return 255
+	}
+	go func() {
+		io.Copy(stdin, s.channel)
+		stdin.Close()
+	}()
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+			return uint32(exitErr.ExitCode())
+		}
+		return 255
+	}
+	return 0
+}
+
+// serve answers the requests of a session until a command has run
+func (s *sshSession) serve(requests <-chan *ssh.Request) {
+	defer s.channel.Close()
+	for req := range requests {
+		var script string
+		switch req.Type {
+		case "env":
+			var payload struct{ Name, Value string }
+			ok := ssh.Unmarshal(req.Payload, &payload) == nil && envName.MatchString(payload.Name)
+			if ok {
+				s.env = append(s.env, payload.Name+"="+payload.Value)
+			}
+			req.Reply(ok, nil)
+			continue
+		case "pty-req":
+			var payload struct {
+				Term                string
+				Columns, Rows, W, H uint32
+				Modes               string
+			}
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.pty, s.term, s.cols, s.rows = true, payload.Term, payload.Columns, payload.Rows
+			req.Reply(true, nil)
+			continue
+		case "shell":
+			script = s.script("")
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			script = s.script(payload.Command)
+		case "subsystem":
+			var payload struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			script = sftpServerScript
+		default:
+			// window-change, agent and X11 forwarding are not supported
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+		status := s.run(script)
+		s.channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// forwardLocal serves a direct-tcpip channel (ssh -L, VS Code) to a port on
+// the container's localhost through a port-forward
+func forwardLocal(proxy *clusterProxy, container string, newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	if payload.Host != "localhost" && payload.Host != "127.0.0.1" && payload.Host != "::1" {
+		newChannel.Reject(ssh.Prohibited, "only ports on localhost of the container can be forwarded")
+		return
+	}
+
+	target := proxyTarget{namespace: proxy.namespace, resource: "pod/" + container}
+	local, release, err := proxy.tunnel(target, strconv.Itoa(int(payload.Port)))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer release()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", local))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		close(done)
+	}()
+	io.Copy(conn, channel)
+	conn.(*net.TCPConn).CloseWrite()
+	<-done
+}
+
+// serveSSH is the SSH server used when the container has none. It runs in
+// ssh-proxy, talks to the ssh client over stdin/stdout and serves every
+// session with kubectl exec.
+func serveSSH(kubeconfigPath string, container string, stream stdioConn, authorized ssh.PublicKey) error {
+	hostKeyPath, err := sshKeyPath(sshHostKeyFile)
+	if err != nil {
+		return err
+	}
+	hostKey, err := loadOrCreateKey(hostKeyPath)
+	if err != nil {
+		return fmt.Errorf("cannot load the host key: %s", err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+		ServerVersion: "SSH-2.0-hpcgame",
+	}
+	config.AddHostKey(hostKey)
+
+	conn, channels, requests, err := ssh.NewServerConn(stream, config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(requests)
+
+	proxy := newClusterProxy(kubeconfigPath)
+	proxy.quiet = true
+	// ssh ends its ProxyCommand with SIGHUP, which runs the exit hooks
+	atExit(proxy.close)
+	go proxy.closeIdleTunnels()
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			session := &sshSession{kubeconfig: kubeconfigPath, container: container, channel: channel}
+			go session.serve(requests)
+		case "direct-tcpip":
+			go forwardLocal(proxy, container, newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "not supported")
+		}
+	}
+	return nil
+}
+
+// sshProxy is the ProxyCommand written by ssh-config. It connects the ssh
+// client on stdin/stdout to dropbear or sshd in the container, or serves the
+// connection itself if the container has neither.
+func sshProxy() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "Usage: hpcgame ssh-proxy CONTAINER")
+		fmt.Fprintln(os.Stderr, "Used as ProxyCommand by the entries of 'hpcgame ssh-config'")
+		exit(exitUsage)
+	}
+	container := os.Args[2]
+
+	// Standard output carries the SSH connection, messages go to stderr
+	stream := stdioConn{Reader: os.Stdin, Writer: os.Stdout}
+	os.Stdout = os.Stderr
+
+	keyPath, err := sshKeyPath(sshKeyFile)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	data, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		fmt.Printf("❌ No SSH key found, run 'hpcgame ssh-config' first\n")
+		exit(exitFailure)
+	}
+	authorized, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		fmt.Printf("❌ Invalid SSH key %s.pub: %s\n", keyPath, err)
+		exit(exitFailure)
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		exit(exitFailure)
+	}
+
+	cmd := kubectlCommand(kubeconfigPath, "exec", "-i", container, "--", "sh", "-c", sshServerScript(strings.TrimSpace(string(data))))
+	var stderr relayedStderr
+	cmd.Stderr = watchExecCredentials(&stderr)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+
+	// The client's input is only passed on once a server answered
+	output := bufio.NewReader(stdout)
+	banner, _ := output.ReadString('\n')
+	if strings.HasPrefix(banner, "SSH-") {
+		debugf("Connected to the SSH server of %s: %s", container, strings.TrimSpace(banner))
+		stderr.connect()
+		io.WriteString(stream, banner)
+		go func() {
+			io.Copy(stdin, os.Stdin)
+			stdin.Close()
+		}()
+		io.Copy(stream, output)
+		cmd.Wait()
+		return
+	}
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil && strings.TrimSpace(banner) != sshNoServer {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		fmt.Printf("❌ Cannot connect to container %s: %s\n", container, message)
+		exit(exitFailure)
+	}
+	debugf("No SSH server in %s, serving the connection with kubectl exec", container)
+	if err := serveSSH(kubeconfigPath, container, stream, authorized); err != nil {
+		fmt.Printf("❌ SSH connection to %s failed: %s\n", container, err)
+		exit(exitFailure)
+	}
+}
+
+// sshConfigQuote quotes a value for ssh_config if needed
+func sshConfigQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// sshHostEntries returns the ssh_config entries for the containers
+func sshHostEntries(names []string, user string, keyPath string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	proxyCommand := sshConfigQuote(filepath.ToSlash(executable))
+	if profile := currentProfile(); profile != defaultProfile {
+		proxyCommand += " --profile " + profile
+	}
+	if namespaceFlag != "" {
+		proxyCommand += " --namespace " + namespaceFlag
+	}
+	proxyCommand += " ssh-proxy %h"
+
+	var b strings.Builder
+	b.WriteString("# Generated by 'hpcgame ssh-config', run it again after creating containers\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\nHost %s\n", name)
+		fmt.Fprintf(&b, "  HostName %s\n", name)
+		fmt.Fprintf(&b, "  User %s\n", user)
+		fmt.Fprintf(&b, "  IdentityFile %s\n", sshConfigQuote(filepath.ToSlash(keyPath)))
+		b.WriteString("  IdentitiesOnly yes\n")
+		// Containers are reached through kubectl, which already authenticates
+		// the cluster; their host keys change whenever they are recreated
+		b.WriteString("  StrictHostKeyChecking no\n")
+		b.WriteString("  UserKnownHostsFile /dev/null\n")
+		b.WriteString("  LogLevel ERROR\n")
+		fmt.Fprintf(&b, "  ProxyCommand %s\n", proxyCommand)
+	}
+	return b.String(), nil
+}
+
+// includeSSHConfig makes ~/.ssh/config include path, before any Host entry
+// so that it applies, and records the line for uninstall
+func includeSSHConfig(path string) (bool, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return false, err
+	}
+	userConfig := filepath.Join(homeDir, ".ssh", "config")
+	include := "Include " + sshConfigQuote(filepath.ToSlash(path))
+	data, err := os.ReadFile(userConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == include {
+			return false, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0700); err != nil {
+		return false, err
+	}
+	text := include + "\n\n"
+	if err := writeFileAtomic(userConfig, append([]byte(text), data...), 0600); err != nil {
+		return false, err
+	}
+	recordArtifact(manifestEntry{Kind: artifactRCText, Path: userConfig, Text: text})
+	return true, nil
+}
+
+func printSSHConfigHelp() {
+	fmt.Println("Usage: hpcgame ssh-config [OPTIONS] [CONTAINER...]")
+	fmt.Println("Prints ssh_config entries for the containers, all of them by default, so that")
+	fmt.Println("ssh, scp, rsync and VS Code Remote-SSH can connect with 'ssh CONTAINER'.")
+	fmt.Println("Connections go through 'hpcgame ssh-proxy', which authorizes a key kept in")
+	fmt.Println("~/.hpcgame/ssh and runs dropbear or sshd in the container if installed;")
+	fmt.Println("otherwise the connection is served locally with kubectl exec.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --write       Save the entries and include them in ~/.ssh/config")
+	fmt.Println("  --user USER   User to log in as with dropbear or sshd (default root)")
+}
+
+func sshConfig() {
+	sshCmd := flag.NewFlagSet("ssh-config", flag.ContinueOnError)
+	write := sshCmd.Bool("write", false, "Save the entries and include them in ~/.ssh/config")
+	user := sshCmd.String("user", "root", "User to log in as")
+	sshCmd.Usage = printSSHConfigHelp
+	names := parseInterspersed(sshCmd, os.Args[2:])
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+	if len(names) == 0 {
+		var stderr bytes.Buffer
+		cmd := kubectlCommand(kubeconfigPath, "get", "pods", "-o", "jsonpath={.items[*].metadata.name}")
+		cmd.Stderr = watchCredentials(&stderr)
+		output, err := cmd.Output()
+		if err != nil {
+			fmt.Printf("❌ Failed to list containers: %s\n", strings.TrimSpace(stderr.String()))
+			exit(exitKubectlFailed)
+		}
+		names = strings.Fields(string(output))
+		if len(names) == 0 {
+			fmt.Println("No containers found, create one with 'hpcgame create' first")
+			exit(exitFailure)
+		}
+	}
+
+	keyPath, err := sshKeyPath(sshKeyFile)
+	if err == nil {
+		_, err = loadOrCreateKey(keyPath)
+	}
+	if err != nil {
+		fmt.Printf("❌ Cannot create the SSH key: %s\n", err)
+		exit(exitFailure)
+	}
+	entries, err := sshHostEntries(names, *user, keyPath)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	if !*write {
+		fmt.Print(entries)
+		return
+	}
+
+	dir, err := profileDir(currentProfile())
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	configPath := filepath.Join(dir, sshConfigFile)
+	if err := writeFileAtomic(configPath, []byte(entries), 0600); err != nil {
+		fmt.Printf("❌ Failed to write %s: %s\n", configPath, err)
+		exit(exitFailure)
+	}
+	fmt.Printf("✅ Wrote %d hosts to %s\n", len(names), configPath)
+	added, err := includeSSHConfig(configPath)
+	if err != nil {
+		fmt.Printf("⚠️ Could not update ~/.ssh/config, add this line at its top: Include %s\n", configPath)
+	} else if added {
+		fmt.Println("✅ Included it in ~/.ssh/config")
+	}
+	fmt.Printf("Connect with 'ssh %s', or pick the host in VS Code Remote-SSH\n", names[0])
+}
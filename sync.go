@@ -0,0 +1,775 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// syncListScript prints a header with the hash command and whether tar is
+// available, then one "HASH  ./path" line per regular file below the directory
+const syncListScript = `h=none
+for c in sha256sum md5sum; do
+  if command -v $c >/dev/null 2>&1; then h=$c; break; fi
+done
+t=notar
+command -v tar >/dev/null 2>&1 && t=tar
+echo "hpcgame-sync $h $t"
+cd %s 2>/dev/null || { echo hpcgame-sync-missing; exit 0; }
+if [ $h = none ]; then find . -type f; else find . -type f -exec $h {} +; fi
+`
+
+// localFile is a regular file below the local sync root
+type localFile struct {
+	path string
+	size int64
+	mode os.FileMode
+}
+
+// syncResult summarizes one sync
+type syncResult struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Added       []string `json:"added"`
+	Updated     []string `json:"updated"`
+	Removed     []string `json:"removed"`
+	Unchanged   int      `json:"unchanged"`
+	Bytes       int64    `json:"bytes"`
+	DryRun      bool     `json:"dry_run,omitempty"`
+}
+
+// syncer keeps a local directory and a directory in a container in step.
+// Only regular files are synced; symlinks and empty directories are skipped.
+type syncer struct {
+	kubeconfig string
+	container  string
+	remote     string
+	local      string
+	push       bool
+	delete     bool
+	dryRun     bool
+	excludes   []string
+	matcher    *ignoreMatcher
+
+	// Local files as of the last sync, kept up to date by watch
+	files map[string]localFile
+
+	// Found out by listRemote
+	hasher        string
+	hasTar        bool
+	remoteMissing bool
+}
+
+// splitContainerPath splits CONTAINER:PATH. Windows drive letters and local
+// paths such as ./a:b are not container paths.
+func splitContainerPath(arg string) (string, string, bool) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.ContainsAny(arg[:i], `/\`) {
+		return "", arg, false
+	}
+	if runtime.GOOS == "windows" && i == 1 {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// remoteShellPath quotes a path in the container for sh, keeping ~ expandable
+func remoteShellPath(p string) string {
+	if p == "" || p == "~" {
+		return `"$HOME"`
+	}
+	if strings.HasPrefix(p, "~/") {
+		return `"$HOME"/` + shellQuote(strings.TrimPrefix(p, "~/"))
+	}
+	return shellQuote(p)
+}
+
+// containerExec runs a shell script in a container. stdin and stdout may be
+// nil. The error carries what the script or kubectl printed on stderr.
+func containerExec(kubeconfigPath string, container string, script string, stdin io.Reader, stdout io.Writer) error {
+	args := []string{"exec"}
+	if stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(args, container, "--", "sh", "-c", script)
+
+	var stderr bytes.Buffer
+	cmd := kubectlCommand(kubeconfigPath, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = watchExecCredentials(&stderr)
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s", message)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *syncer) execIn(script string, stdin io.Reader, stdout io.Writer) error {
+	return containerExec(s.kubeconfig, s.container, script, stdin, stdout)
+}
+
+// listRemote returns the hash of every file below the remote directory. The
+// hash is empty if the container has neither sha256sum nor md5sum.
+func (s *syncer) listRemote() (map[string]string, error) {
+	var out bytes.Buffer
+	if err := s.execIn(fmt.Sprintf(syncListScript, remoteShellPath(s.remote)), nil, &out); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(&out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("unexpected output from container")
+	}
+	header := strings.Fields(scanner.Text())
+	if len(header) != 3 || header[0] != "hpcgame-sync" {
+		return nil, fmt.Errorf("unexpected output from container: %s", scanner.Text())
+	}
+	s.hasher = header[1]
+	s.hasTar = header[2] == "tar"
+	if s.hasher == "none" {
+		fmt.Println("⚠️ The container has neither sha256sum nor md5sum, all files will be transferred")
+	}
+
+	files := map[string]string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "hpcgame-sync-missing" {
+			s.remoteMissing = true
+			break
+		}
+		checksum := ""
+		if s.hasher != "none" {
+			escaped := strings.HasPrefix(line, `\`)
+			parts := strings.SplitN(strings.TrimPrefix(line, `\`), "  ", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			checksum, line = parts[0], parts[1]
+			if escaped {
+				line = unescapeChecksumName(line)
+			}
+		}
+		rel := strings.TrimPrefix(line, "./")
+		if rel == "" || s.matcher.ignored(rel, false) {
+			continue
+		}
+		files[rel] = checksum
+	}
+	return files, scanner.Err()
+}
+
+// unescapeChecksumName decodes a name that sha256sum or md5sum escaped
+// because it holds a backslash, newline or carriage return
+func unescapeChecksumName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' || i+1 == len(name) {
+			b.WriteByte(name[i])
+			continue
+		}
+		i++
+		switch name[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(name[i])
+		}
+	}
+	return b.String()
+}
+
+// walkLocal lists the regular files below the local directory, loading
+// .hpcgameignore and .gitignore files on the way
+func (s *syncer) walkLocal() (map[string]localFile, error) {
+	files := map[string]localFile{}
+	info, err := os.Stat(s.local)
+	if os.IsNotExist(err) && !s.push {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", s.local)
+	}
+
+	s.matcher.load(filepath.Join(s.local, hpcgameIgnoreFile), "")
+	return files, s.walkFrom(s.local, files)
+}
+
+// walkFrom adds the files below start, a directory inside the local root
+func (s *syncer) walkFrom(start string, files map[string]localFile) error {
+	return filepath.WalkDir(start, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.local, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			s.matcher.load(filepath.Join(p, ".gitignore"), "")
+			return nil
+		}
+		if s.matcher.match(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			s.matcher.load(filepath.Join(p, ".gitignore"), rel)
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = localFile{path: p, size: info.Size(), mode: info.Mode()}
+		return nil
+	})
+}
+
+// hashFile hashes a local file with the algorithm the container uses
+func hashFile(p string, hasher string) (string, error) {
+	var h hash.Hash
+	switch hasher {
+	case "sha256sum":
+		h = sha256.New()
+	case "md5sum":
+		h = md5.New()
+	default:
+		return "", nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// upload sends local files to the remote directory, as one tar stream if the
+// container has tar and one exec per file otherwise
+func (s *syncer) upload(rels []string, files map[string]localFile) (int64, error) {
+	var total int64
+	for _, rel := range rels {
+		total += files[rel].size
+	}
+	remoteDir := remoteShellPath(s.remote)
+
+	if !s.hasTar {
+		for _, rel := range rels {
+			f, err := os.Open(files[rel].path)
+			if err != nil {
+				return 0, err
+			}
+			script := fmt.Sprintf(`f=%s/%s; mkdir -p "$(dirname "$f")" && cat > "$f"`, remoteDir, shellQuote(rel))
+			if files[rel].mode&0111 != 0 {
+				script += ` && chmod +x "$f"`
+			}
+			err = s.execIn(script, f, nil)
+			f.Close()
+			if err != nil {
+				return 0, fmt.Errorf("failed to copy %s: %s", rel, err)
+			}
+		}
+		return total, nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeSyncTar(writer, rels, files))
+	}()
+	err := s.execIn(fmt.Sprintf("mkdir -p %[1]s && cd %[1]s && tar -x -o -f -", remoteDir), reader, nil)
+	// Unblock the writer if tar exited early
+	reader.Close()
+	return total, err
+}
+
+func writeSyncTar(w io.Writer, rels []string, files map[string]localFile) error {
+	tw := tar.NewWriter(w)
+	for _, rel := range rels {
+		file := files[rel]
+		f, err := os.Open(file.path)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     rel,
+			Size:     info.Size(),
+			Mode:     int64(info.Mode().Perm()),
+			ModTime:  info.ModTime(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			f.Close()
+			return err
+		}
+		// The file may have grown since it was listed
+		_, err = io.CopyN(tw, f, header.Size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// removeRemote deletes files in the remote directory and the directories
+// that become empty
+func (s *syncer) removeRemote(rels []string) error {
+	script := fmt.Sprintf(`cd %s || exit 1
+while IFS= read -r f; do
+  rm -f -- "$f"
+  rmdir -p -- "$(dirname -- "$f")" 2>/dev/null
+done
+exit 0`, remoteShellPath(s.remote))
+	return s.execIn(script, strings.NewReader(strings.Join(rels, "\n")+"\n"), nil)
+}
+
+// download fetches remote files into the local directory. Without tar the
+// mode of the remote file is unknown, so existing local files keep theirs.
+func (s *syncer) download(rels []string, files map[string]localFile) (int64, error) {
+	remoteDir := remoteShellPath(s.remote)
+	if !s.hasTar {
+		var total int64
+		for _, rel := range rels {
+			var out bytes.Buffer
+			if err := s.execIn(fmt.Sprintf("cat -- %s/%s", remoteDir, shellQuote(rel)), nil, &out); err != nil {
+				return total, fmt.Errorf("failed to copy %s: %s", rel, err)
+			}
+			mode := os.FileMode(0644)
+			if file, ok := files[rel]; ok {
+				mode = file.mode.Perm()
+			}
+			size := int64(out.Len())
+			if err := s.writeLocal(rel, &out, mode); err != nil {
+				return total, err
+			}
+			total += size
+		}
+		return total, nil
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	var total int64
+	go func() {
+		var err error
+		total, err = s.extractSyncTar(reader)
+		// Drain the stream so that tar in the container can finish
+		io.Copy(io.Discard, reader)
+		done <- err
+	}()
+	err := s.execIn(fmt.Sprintf("cd %s && tar -c -f - -T -", remoteDir), strings.NewReader(strings.Join(rels, "\n")+"\n"), writer)
+	writer.CloseWithError(err)
+	if extractErr := <-done; err == nil {
+		err = extractErr
+	}
+	return total, err
+}
+
+func (s *syncer) extractSyncTar(r io.Reader) (int64, error) {
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := s.writeLocal(header.Name, tr, os.FileMode(header.Mode).Perm()); err != nil {
+			return total, err
+		}
+		total += header.Size
+	}
+}
+
+// writeLocal writes a file below the local directory, refusing paths that
+// would escape it, also through symlinks
+func (s *syncer) writeLocal(rel string, r io.Reader, mode os.FileMode) error {
+	rel = path.Clean(strings.TrimPrefix(rel, "./"))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return fmt.Errorf("refusing to write %s outside of %s", rel, s.local)
+	}
+	if err := checkNoSymlinks(s.local, rel); err != nil {
+		return err
+	}
+	target := filepath.Join(s.local, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// Replace a symlink rather than writing to where it points
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, mode)
+}
+
+// checkNoSymlinks refuses to extract rel below dir through a symlink, such
+// as one created by an earlier entry of the same archive
+func checkNoSymlinks(dir string, rel string) error {
+	parts := strings.Split(rel, "/")
+	current := dir
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write %s through the symlink %s", rel, current)
+		}
+	}
+	return nil
+}
+
+// removeLocal deletes local files and the directories that become empty
+func (s *syncer) removeLocal(rels []string, files map[string]localFile) error {
+	for _, rel := range rels {
+		if err := os.Remove(files[rel].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for dir := filepath.Dir(files[rel].path); dir != s.local && strings.HasPrefix(dir, s.local); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// run compares both sides and transfers what differs
+func (s *syncer) run() (*syncResult, error) {
+	result := &syncResult{Added: []string{}, Updated: []string{}, Removed: []string{}, DryRun: s.dryRun}
+	remoteName := s.container + ":" + s.remote
+	if s.push {
+		result.Source, result.Destination = s.local, remoteName
+	} else {
+		result.Source, result.Destination = remoteName, s.local
+	}
+
+	s.matcher = newIgnoreMatcher(s.excludes)
+	localFiles, err := s.walkLocal()
+	if err != nil {
+		return nil, err
+	}
+	remoteFiles, err := s.listRemote()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %s", remoteName, err)
+	}
+	if s.remoteMissing && !s.push {
+		return nil, fmt.Errorf("%s does not exist", remoteName)
+	}
+
+	source, target := map[string]bool{}, map[string]bool{}
+	for rel := range localFiles {
+		source[rel] = true
+	}
+	for rel := range remoteFiles {
+		target[rel] = true
+	}
+	if !s.push {
+		source, target = target, source
+	}
+
+	for rel := range source {
+		if !target[rel] {
+			result.Added = append(result.Added, rel)
+			continue
+		}
+		localHash, err := hashFile(localFiles[rel].path, s.hasher)
+		if err != nil {
+			return nil, err
+		}
+		if localHash == "" || localHash != remoteFiles[rel] {
+			result.Updated = append(result.Updated, rel)
+		} else {
+			result.Unchanged++
+		}
+	}
+	if s.delete {
+		for rel := range target {
+			if !source[rel] {
+				result.Removed = append(result.Removed, rel)
+			}
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+
+	transfer := append(append([]string{}, result.Added...), result.Updated...)
+	if s.dryRun {
+		for _, rel := range transfer {
+			if s.push {
+				result.Bytes += localFiles[rel].size
+			}
+		}
+		return result, nil
+	}
+
+	if len(transfer) > 0 {
+		if s.push {
+			result.Bytes, err = s.upload(transfer, localFiles)
+		} else {
+			result.Bytes, err = s.download(transfer, localFiles)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer files: %s", err)
+		}
+	}
+	if len(result.Removed) > 0 {
+		if s.push {
+			err = s.removeRemote(result.Removed)
+		} else {
+			err = s.removeLocal(result.Removed, localFiles)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove files: %s", err)
+		}
+	}
+	s.files = localFiles
+	return result, nil
+}
+
+func (r *syncResult) print(verbose bool) {
+	if verbose || r.DryRun {
+		for _, rel := range r.Added {
+			fmt.Printf("  + %s\n", rel)
+		}
+		for _, rel := range r.Updated {
+			fmt.Printf("  ~ %s\n", rel)
+		}
+		for _, rel := range r.Removed {
+			fmt.Printf("  - %s\n", rel)
+		}
+	}
+	summary := fmt.Sprintf("%d added, %d updated, %d removed, %d unchanged (%s)",
+		len(r.Added), len(r.Updated), len(r.Removed), r.Unchanged, formatBytes(r.Bytes))
+	if r.DryRun {
+		fmt.Printf("Would sync %s -> %s: %s\n", r.Source, r.Destination, summary)
+	} else {
+		fmt.Printf("✅ Synced %s -> %s: %s\n", r.Source, r.Destination, summary)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// newSyncer builds a syncer from SOURCE and DEST, one of which is CONTAINER:PATH
+func newSyncer(kubeconfigPath string, source string, destination string) (*syncer, error) {
+	s := &syncer{kubeconfig: kubeconfigPath}
+	sourceContainer, sourcePath, sourceRemote := splitContainerPath(source)
+	destContainer, destPath, destRemote := splitContainerPath(destination)
+	switch {
+	case sourceRemote && destRemote:
+		return nil, fmt.Errorf("one side of the sync must be a local directory")
+	case destRemote:
+		s.push = true
+		s.container, s.remote, s.local = destContainer, destPath, source
+	case sourceRemote:
+		s.container, s.remote, s.local = sourceContainer, sourcePath, destination
+	default:
+		return nil, fmt.Errorf("one side of the sync must be CONTAINER:PATH")
+	}
+	if s.remote == "" {
+		return nil, fmt.Errorf("no path given in the container")
+	}
+	local, err := filepath.Abs(expandHome(s.local))
+	if err != nil {
+		return nil, err
+	}
+	s.local = local
+	return s, nil
+}
+
+func printSyncHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  hpcgame sync [OPTIONS] LOCAL_DIR CONTAINER:PATH   Upload changed files")
+	fmt.Println("  hpcgame sync [OPTIONS] CONTAINER:PATH LOCAL_DIR   Download changed files")
+	fmt.Println("  hpcgame sync [OPTIONS] [CONTAINER]                Run the sync rules of .hpcgame.yaml")
+	fmt.Println()
+	fmt.Println("Files are compared by checksum, so only new and changed files are transferred.")
+	fmt.Printf("Paths matched by .gitignore, %s or --exclude are skipped.\n", hpcgameIgnoreFile)
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --exclude PATTERN   Skip matching paths (repeatable, .gitignore syntax)")
+	fmt.Println("  --delete            Delete files that no longer exist on the source side")
+	fmt.Println("  --dry-run           Only show what would be transferred (not with --watch)")
+	fmt.Println("  -v, --verbose       List every transferred and deleted file (--verbose also prints kubectl commands)")
+	fmt.Println("  --watch             Keep watching the local directory and push changes as they happen")
+	fmt.Println("  --run COMMAND       With --watch, run COMMAND in the remote directory after each sync")
+	fmt.Println("  --debounce 300ms    With --watch, wait until files have been quiet this long")
+}
+
+func syncFiles() {
+	syncCmd := flag.NewFlagSet("sync", flag.ContinueOnError)
+	var excludes stringList
+	syncCmd.Var(&excludes, "exclude", "Skip matching paths (repeatable)")
+	deleteFlag := syncCmd.Bool("delete", false, "Delete files missing on the source side")
+	dryRun := syncCmd.Bool("dry-run", false, "Only show what would be transferred")
+	// --verbose is taken by the global flags, which list the files as well
+	listFiles := syncCmd.Bool("v", false, "List every transferred file")
+	watchFlag := syncCmd.Bool("watch", false, "Keep watching the local directory and push changes")
+	runFlag := syncCmd.String("run", "", "Command to run in the remote directory after each sync (with --watch)")
+	debounce := syncCmd.Duration("debounce", defaultSyncDebounce, "Wait until files have been quiet this long before syncing")
+	syncCmd.Usage = printSyncHelp
+	args := parseInterspersed(syncCmd, os.Args[2:])
+	showFiles := *listFiles || verbose()
+
+	type syncJob struct {
+		source, destination string
+		excludes            []string
+		delete              bool
+	}
+	var jobs []syncJob
+	switch len(args) {
+	case 0, 1:
+		project := loadProject()
+		if project == nil || len(project.Sync) == 0 {
+			printSyncHelp()
+			return
+		}
+		containerName := loadSettings().String("name")
+		if len(args) == 1 {
+			containerName = args[0]
+		}
+		if containerName == "" {
+			fmt.Println("Container name required")
+			fmt.Println("Usage: hpcgame sync CONTAINER")
+			fmt.Printf("Or set 'container.name' in %s\n", project.Path)
+			return
+		}
+		for _, rule := range project.Sync {
+			jobs = append(jobs, syncJob{rule.Local, containerName + ":" + rule.Remote, rule.Exclude, rule.Delete})
+		}
+	case 2:
+		jobs = append(jobs, syncJob{args[0], args[1], nil, false})
+	default:
+		printSyncHelp()
+		return
+	}
+
+	if *runFlag != "" && !*watchFlag {
+		fmt.Println("❌ --run can only be used with --watch")
+		exit(exitUsage)
+	}
+	if *dryRun && *watchFlag {
+		fmt.Println("❌ --dry-run cannot be used with --watch")
+		exit(exitUsage)
+	}
+
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return
+	}
+
+	var results []*syncResult
+	var syncers []*syncer
+	failed := false
+	for _, job := range jobs {
+		s, err := newSyncer(kubeconfigPath, job.source, job.destination)
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			exit(exitUsage)
+		}
+		if *watchFlag && !s.push {
+			fmt.Println("❌ --watch only supports uploading a local directory into a container")
+			exit(exitUsage)
+		}
+		s.delete = *deleteFlag || job.delete
+		s.dryRun = *dryRun
+		s.excludes = append(job.excludes, excludes...)
+
+		if !outputJSON() {
+			fmt.Printf("Syncing %s -> %s\n", job.source, job.destination)
+		}
+		result, err := s.run()
+		if err != nil {
+			fmt.Printf("❌ %s\n", err)
+			failed = true
+			continue
+		}
+		results = append(results, result)
+		syncers = append(syncers, s)
+		if !outputJSON() {
+			result.print(showFiles)
+		}
+	}
+
+	if *watchFlag && !failed {
+		watchSyncs(syncers, *debounce, *runFlag, showFiles)
+		return
+	}
+	if outputJSON() {
+		printJSON(results)
+	}
+	if failed {
+		exit(exitFailure)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultSyncDebounce = 300 * time.Millisecond
+	maxSyncRetryDelay   = 30 * time.Second
+)
+
+// watchSyncLock serializes syncs and --run commands when several sync rules
+// are watched at once
+var watchSyncLock sync.Mutex
+
+// addWatches watches dir and every directory below it that is not ignored
+func (s *syncer) addWatches(watcher *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(s.local, p); err == nil && rel != "." && s.matcher.ignored(filepath.ToSlash(rel), true) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			fmt.Printf("⚠️ Cannot watch %s: %s\n", p, err)
+		}
+		return nil
+	})
+}
+
+// pushChanges uploads the changed paths, which may be files or directories,
+// and removes deleted ones from the container if --delete was given
+func (s *syncer) pushChanges(changed map[string]bool) (*syncResult, error) {
+	result := &syncResult{
+		Source:      s.local,
+		Destination: s.container + ":" + s.remote,
+		Added:       []string{},
+		Updated:     []string{},
+		Removed:     []string{},
+	}
+
+	current := map[string]localFile{}
+	var removed []string
+	for rel := range changed {
+		p := filepath.Join(s.local, filepath.FromSlash(rel))
+		info, err := os.Lstat(p)
+		switch {
+		case err != nil:
+			// Deleted, possibly a whole directory
+			for known := range s.files {
+				if known == rel || strings.HasPrefix(known, rel+"/") {
+					removed = append(removed, known)
+				}
+			}
+		case info.IsDir():
+			if err := s.walkFrom(p, current); err != nil {
+				return nil, err
+			}
+		case info.Mode().IsRegular() && !s.matcher.ignored(rel, false):
+			current[rel] = localFile{path: p, size: info.Size(), mode: info.Mode()}
+		}
+	}
+
+	var transfer []string
+	for rel := range current {
+		if _, ok := s.files[rel]; ok {
+			result.Updated = append(result.Updated, rel)
+		} else {
+			result.Added = append(result.Added, rel)
+		}
+		transfer = append(transfer, rel)
+	}
+	sort.Strings(transfer)
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+
+	if len(transfer) > 0 {
+		bytes, err := s.upload(transfer, current)
+		if err != nil {
+			return nil, err
+		}
+		result.Bytes = bytes
+	}
+	for rel, file := range current {
+		s.files[rel] = file
+	}
+
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		if s.delete {
+			if err := s.removeRemote(removed); err != nil {
+				return nil, err
+			}
+			result.Removed = removed
+		}
+		for _, rel := range removed {
+			delete(s.files, rel)
+		}
+	}
+	return result, nil
+}
+
+// runAfterSync runs the --run command in the remote directory
+func (s *syncer) runAfterSync(command string) {
+	fmt.Printf("Running: %s\n", command)
+	cmd := kubectlCommand(s.kubeconfig, "exec", s.container, "--", "sh", "-c",
+		fmt.Sprintf("cd %s && %s", remoteShellPath(s.remote), command))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = watchExecCredentials(os.Stderr)
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("❌ %s failed: %s\n", command, err)
+		return
+	}
+	fmt.Printf("✅ %s finished\n", command)
+}
+
+// watch pushes local changes into the container until interrupted. Changes
+// are collected until the tree has been quiet for debounce. If a transfer
+// fails, for example because the exec stream was cut, it is retried with a
+// full sync after a growing delay.
+func (s *syncer) watch(debounce time.Duration, runCommand string, verbose bool) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %s", s.local, err)
+	}
+	defer watcher.Close()
+	s.addWatches(watcher, s.local)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	changed := map[string]bool{}
+	resync := false
+	retryDelay := time.Second
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(s.local, event.Name)
+			if err != nil || rel == "." {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			info, statErr := os.Lstat(event.Name)
+			isDir := statErr == nil && info.IsDir()
+			if name := path.Base(rel); name == ".gitignore" || name == hpcgameIgnoreFile {
+				// The ignore rules changed, compare everything again
+				resync = true
+			} else if s.matcher.ignored(rel, isDir) {
+				continue
+			}
+			if isDir && event.Has(fsnotify.Create) {
+				s.addWatches(watcher, event.Name)
+			}
+			changed[rel] = true
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("⚠️ Watch error: %s\n", err)
+			// Events may have been lost
+			resync = true
+			timer.Reset(debounce)
+
+		case <-timer.C:
+			watchSyncLock.Lock()
+			var result *syncResult
+			if resync {
+				result, err = s.run()
+				if err == nil {
+					s.addWatches(watcher, s.local)
+				}
+			} else {
+				result, err = s.pushChanges(changed)
+			}
+			if err != nil {
+				watchSyncLock.Unlock()
+				fmt.Printf("⚠️ [%s] Sync failed: %s\n", time.Now().Format("15:04:05"), err)
+				fmt.Printf("Retrying in %s\n", retryDelay)
+				resync = true
+				timer.Reset(retryDelay)
+				retryDelay = min(retryDelay*2, maxSyncRetryDelay)
+				continue
+			}
+			resync = false
+			retryDelay = time.Second
+			changed = map[string]bool{}
+
+			transferred := len(result.Added) + len(result.Updated) + len(result.Removed)
+			if transferred > 0 {
+				result.print(verbose)
+				if runCommand != "" {
+					s.runAfterSync(runCommand)
+				}
+			}
+			watchSyncLock.Unlock()
+		}
+	}
+}
+
+// watchSyncs watches every synced directory until interrupted
+func watchSyncs(syncers []*syncer, debounce time.Duration, runCommand string, verbose bool) {
+	if runCommand != "" && len(syncers) > 0 {
+		watchSyncLock.Lock()
+		syncers[0].runAfterSync(runCommand)
+		watchSyncLock.Unlock()
+	}
+	fmt.Println("Watching for changes, press Ctrl+C to stop")
+
+	var wg sync.WaitGroup
+	for _, s := range syncers {
+		wg.Add(1)
+		go func(s *syncer) {
+			defer wg.Done()
+			if err := s.watch(debounce, runCommand, verbose); err != nil {
+				fmt.Printf("❌ %s\n", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
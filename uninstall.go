@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manifestFile = "install-manifest.json"
+
+// Kinds of artifacts recorded in the install manifest
+const (
+	artifactFile      = "file"
+	artifactDir       = "dir"
+	artifactRCText    = "rc-text"
+	artifactRCBlock   = "rc-block"
+	artifactExtension = "vscode-extension"
+
+	artifactKubeconfigEntry = "kubeconfig-entry"
+)
+
+// manifestEntry is one change made by install that uninstall can undo
+type manifestEntry struct {
+	Kind string `json:"kind"`
+	Path string `json:"path,omitempty"`
+	Text string `json:"text,omitempty"`
+	Sudo bool   `json:"sudo,omitempty"`
+}
+
+type installManifest struct {
+	Updated time.Time       `json:"updated"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+func manifestPath() (string, error) {
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hpcgameDir, manifestFile), nil
+}
+
+func loadManifest() (*installManifest, error) {
+	path, err := manifestPath()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &installManifest{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	return manifest, nil
+}
+
+// recordArtifact adds an entry to the install manifest. Failures are only
+// reported, since they must not abort the installation itself.
+func recordArtifact(entry manifestEntry) {
+	manifest, err := loadManifest()
+	if err != nil {
+		fmt.Printf("⚠️ Failed to read install manifest: %s\n", err)
+		return
+	}
+	for _, existing := range manifest.Entries {
+		if existing == entry {
+			return
+		}
+	}
+	manifest.Entries = append(manifest.Entries, entry)
+	manifest.Updated = time.Now()
+
+	path, err := manifestPath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		fmt.Printf("⚠️ Failed to write install manifest: %s\n", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Printf("⚠️ Failed to write install manifest: %s\n", err)
+	}
+}
+
+func uninstall() {
+	uninstallCmd := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	dryRun := uninstallCmd.Bool("dry-run", false, "Show what would be removed without changing anything")
+	remote := uninstallCmd.Bool("remote", false, "Also delete your containers and non-default volumes on the cluster")
+	yes := uninstallCmd.Bool("yes", false, "Do not ask for confirmation")
+	uninstallCmd.BoolVar(yes, "y", false, "Do not ask for confirmation (short)")
+	parseFlags(uninstallCmd, os.Args[2:])
+	assumeYes = *yes
+
+	manifest, err := loadManifest()
+	if err != nil {
+		fmt.Printf("Failed to read install manifest: %s\n", err)
+		return
+	}
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		fmt.Printf("Failed to get user home directory: %s\n", err)
+		return
+	}
+
+	entries := manifest.Entries
+	if len(entries) == 0 {
+		fmt.Println("⚠️ No install manifest found, only removing the HPCGame directory and hpcgame lines in shell rc files")
+		entries = legacyArtifacts(hpcgameDir)
+	}
+
+	if *remote {
+		if !removeRemoteResources(*dryRun) {
+			return
+		}
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, the following would be removed:")
+		for _, entry := range entries {
+			fmt.Printf("  - %s\n", describeArtifact(entry))
+		}
+		return
+	}
+
+	fmt.Println("The following will be removed:")
+	for _, entry := range entries {
+		fmt.Printf("  - %s\n", describeArtifact(entry))
+	}
+	if !askYesNo("Continue?") {
+		fmt.Println("Operation cancelled")
+		return
+	}
+
+	// Forget cached passphrases before the agent's socket is removed
+	agentCall(agentRequest{Op: "stop"})
+
+	// Undo in reverse order, so the HPCGame directory itself goes last
+	failed := false
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := removeArtifact(entries[i]); err != nil {
+			fmt.Printf("❌ Failed to remove %s: %s\n", describeArtifact(entries[i]), err)
+			failed = true
+		} else {
+			fmt.Printf("✅ Removed %s\n", describeArtifact(entries[i]))
+		}
+	}
+
+	if failed {
+		fmt.Println("Uninstall finished with errors")
+		exit(exitFailure)
+	}
+	fmt.Println("✅ Uninstall complete. You can now delete the hpcgame binary itself.")
+}
+
+// legacyArtifacts guesses what an install without a manifest changed
+func legacyArtifacts(hpcgameDir string) []manifestEntry {
+	var entries []manifestEntry
+	if _, err := os.Stat(hpcgameDir); err == nil {
+		entries = append(entries, manifestEntry{Kind: artifactDir, Path: hpcgameDir})
+	}
+	text := fmt.Sprintf("\nexport PATH=$PATH:%s\n", filepath.Join(hpcgameDir, "bin"))
+	for _, shell := range supportedShells {
+		rcPath := shellRCPath(shell)
+		data, err := os.ReadFile(rcPath)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(data), text) {
+			entries = append(entries, manifestEntry{Kind: artifactRCText, Path: rcPath, Text: text})
+		}
+		if strings.Contains(string(data), rcBlockStart) {
+			entries = append(entries, manifestEntry{Kind: artifactRCBlock, Path: rcPath})
+		}
+	}
+	return entries
+}
+
+func describeArtifact(entry manifestEntry) string {
+	switch entry.Kind {
+	case artifactFile:
+		return "file " + entry.Path
+	case artifactDir:
+		return "directory " + entry.Path
+	case artifactRCText:
+		return fmt.Sprintf("%q from %s", strings.TrimSpace(entry.Text), entry.Path)
+	case artifactRCBlock:
+		return fmt.Sprintf("hpcgame block from %s", entry.Path)
+	case artifactExtension:
+		return "VSCode extension " + entry.Path
+	case artifactKubeconfigEntry:
+		return fmt.Sprintf("context %s from %s", entry.Text, entry.Path)
+	}
+	return entry.Kind + " " + entry.Path
+}
+
+func removeArtifact(entry manifestEntry) error {
+	switch entry.Kind {
+	case artifactFile, artifactDir:
+		// Older installs recorded rc files they created, which may hold the
+		// user's own settings by now
+		if entry.Kind == artifactFile && isShellRC(entry.Path) {
+			return removeBlankRC(entry.Path)
+		}
+		if entry.Sudo {
+			cmd := exec.Command("sudo", "rm", "-rf", entry.Path)
+			cmd.Stdin = os.Stdin
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		}
+		return os.RemoveAll(entry.Path)
+	case artifactRCText:
+		return removeRCText(entry.Path, entry.Text)
+	case artifactRCBlock:
+		return removeRCBlock(entry.Path)
+	case artifactKubeconfigEntry:
+		return removeKubeconfigEntries(entry.Path, entry.Text)
+	case artifactExtension:
+		if _, err := exec.LookPath("code"); err != nil {
+			return fmt.Errorf("'code' command not found")
+		}
+		return exec.Command("code", "--uninstall-extension", entry.Path).Run()
+	}
+	return fmt.Errorf("unknown artifact kind %q", entry.Kind)
+}
+
+// removeRCText deletes the last occurrence of exactly the text install appended
+func removeRCText(path string, text string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	i := strings.LastIndex(content, text)
+	if i < 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content[:i]+content[i+len(text):]), info.Mode().Perm())
+}
+
+// removeRemoteResources deletes all containers and non-default volumes after confirmation
+func removeRemoteResources(dryRun bool) bool {
+	kubeconfigPath := getKubeConfig()
+	if kubeconfigPath == "" {
+		return false
+	}
+
+	pods, err := kubectlCommand(kubeconfigPath, "get", "pods", "-o", "jsonpath={.items[*].metadata.name}").Output()
+	if err != nil {
+		fmt.Printf("Failed to get container list: %s\n", err)
+		return false
+	}
+	pvcs, err := kubectlCommand(kubeconfigPath, "get", "pvc", "-o", "jsonpath={.items[*].metadata.name}").Output()
+	if err != nil {
+		fmt.Printf("Failed to get volume list: %s\n", err)
+		return false
+	}
+
+	containers := strings.Fields(string(pods))
+	var volumes []string
+	for _, name := range strings.Fields(string(pvcs)) {
+		if !strings.Contains(name, "-default-pvc") {
+			volumes = append(volumes, name)
+		}
+	}
+
+	if len(containers) == 0 && len(volumes) == 0 {
+		fmt.Println("No remote containers or volumes to delete")
+		return true
+	}
+
+	fmt.Printf("Remote resources in namespace %s:\n", resolveNamespace(kubeconfigPath))
+	for _, name := range containers {
+		fmt.Printf("  - container %s\n", name)
+	}
+	for _, name := range volumes {
+		fmt.Printf("  - volume %s (all data on it will be lost)\n", name)
+	}
+	if dryRun {
+		return true
+	}
+	if !askYesNo("Delete these containers and volumes?") {
+		fmt.Println("Keeping remote resources")
+		return true
+	}
+
+	for _, name := range containers {
+		if err := kubectlCommand(kubeconfigPath, "delete", "pod", name, "--wait=false").Run(); err != nil {
+			fmt.Printf("❌ Failed to remove container %s: %s\n", name, err)
+		} else {
+			fmt.Printf("✅ Container %s removed\n", name)
+		}
+	}
+	for _, name := range volumes {
+		if err := deleteVolume(kubeconfigPath, name); err != nil {
+			fmt.Printf("❌ Failed to delete volume %s: %s\n", name, err)
+		}
+	}
+	return true
+}
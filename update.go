@@ -0,0 +1,389 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	updateStateFile     = "update-check.json"
+	updateCheckInterval = 24 * time.Hour
+	checksumsAsset      = "checksums.txt"
+)
+
+// release is the part of a GitHub release hpcgame needs
+type release struct {
+	TagName string         `json:"tag_name"`
+	HTMLURL string         `json:"html_url"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// updateState remembers the last daily check
+type updateState struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+}
+
+// releaseArchiveName returns the archive the build workflow produces for this platform
+func releaseArchiveName() string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf("hpcgame-%s-%s.zip", runtime.GOOS, runtime.GOARCH)
+	}
+	return fmt.Sprintf("hpcgame-%s-%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+}
+
+func (r *release) asset(name string) *releaseAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+func fetchLatestRelease(timeout time.Duration) (*release, error) {
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest("GET", loadSettings().String("update_url"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "hpcgame/"+version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check for updates: %s", resp.Status)
+	}
+
+	latest := &release{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(latest); err != nil {
+		return nil, fmt.Errorf("failed to parse release information: %s", err)
+	}
+	if _, _, _, ok := parseVersion(latest.TagName); !ok {
+		return nil, fmt.Errorf("unexpected release tag %q", latest.TagName)
+	}
+	return latest, nil
+}
+
+// releaseBuild reports whether the running binary has a release version
+func releaseBuild() bool {
+	_, _, _, ok := parseVersion(version)
+	return ok
+}
+
+// newerVersion reports whether latest is newer than the running version
+func newerVersion(latest string) bool {
+	if !releaseBuild() {
+		// Development builds are never updated automatically
+		return false
+	}
+	return compareVersions(latest, version) > 0
+}
+
+// releaseChecksum looks up an asset in the release's checksums.txt
+func releaseChecksum(r *release, name string) (string, error) {
+	asset := r.asset(checksumsAsset)
+	if asset == nil {
+		return "", fmt.Errorf("release %s has no %s", r.TagName, checksumsAsset)
+	}
+	resp, err := http.Get(asset.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get %s: %s", checksumsAsset, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("%s is not listed in %s", name, checksumsAsset)
+}
+
+// extractBinary copies the hpcgame executable out of a release archive
+func extractBinary(archive string, dest io.Writer) error {
+	binary := "hpcgame"
+	if runtime.GOOS == "windows" {
+		binary = "hpcgame.exe"
+	}
+
+	if strings.HasSuffix(archive, ".zip") || runtime.GOOS == "windows" {
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		for _, file := range reader.File {
+			if filepath.Base(file.Name) == binary {
+				rc, err := file.Open()
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				_, err = io.Copy(dest, rc)
+				return err
+			}
+		}
+		return fmt.Errorf("%s not found in the archive", binary)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in the archive", binary)
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == binary {
+			_, err = io.Copy(dest, tr)
+			return err
+		}
+	}
+}
+
+// replaceExecutable atomically swaps the running binary for the new one
+func replaceExecutable(archive string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	return executable, replaceBinary(archive, executable)
+}
+
+// replaceBinary swaps executable for the binary in archive
+func replaceBinary(archive string, executable string) error {
+	dir := filepath.Dir(executable)
+	tmpFile, err := os.CreateTemp(dir, ".hpcgame-update-*")
+	if err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("%s is not writable, run 'sudo hpcgame update' or download the release manually", dir)
+		}
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := extractBinary(archive, tmpFile); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
+		return err
+	}
+
+	// A running executable cannot be overwritten on Windows, but it can be renamed
+	if runtime.GOOS == "windows" {
+		old := executable + ".old"
+		os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpFile.Name(), executable); err != nil {
+			os.Rename(old, executable)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmpFile.Name(), executable)
+}
+
+func update() {
+	updateCmd := flag.NewFlagSet("update", flag.ContinueOnError)
+	check := updateCmd.Bool("check", false, "Only check whether a new version is available")
+	force := updateCmd.Bool("force", false, "Reinstall the latest release even if it is not newer")
+	yes := updateCmd.Bool("yes", false, "Do not ask for confirmation")
+	updateCmd.BoolVar(yes, "y", false, "Do not ask for confirmation (short)")
+	parseFlags(updateCmd, os.Args[2:])
+	assumeYes = assumeYes || *yes
+
+	fmt.Printf("Current version: %s\n", version)
+	latest, err := fetchLatestRelease(30 * time.Second)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+	saveUpdateState(latest.TagName)
+	fmt.Printf("Latest release:  %s\n", strings.TrimPrefix(latest.TagName, "v"))
+
+	if !newerVersion(latest.TagName) && !*force {
+		if !releaseBuild() {
+			fmt.Println("This is a development build, run 'hpcgame update --force' to replace it with the release")
+			return
+		}
+		fmt.Println("✅ hpcgame is up to date")
+		return
+	}
+	if *check {
+		fmt.Println("Run 'hpcgame update' to install it")
+		if latest.HTMLURL != "" {
+			fmt.Printf("Release notes: %s\n", latest.HTMLURL)
+		}
+		return
+	}
+
+	name := releaseArchiveName()
+	asset := latest.asset(name)
+	if asset == nil {
+		fmt.Printf("❌ Release %s has no build for %s/%s (%s)\n", latest.TagName, runtime.GOOS, runtime.GOARCH, name)
+		exit(exitFailure)
+	}
+	checksum, err := releaseChecksum(latest, name)
+	if err != nil {
+		fmt.Printf("❌ %s\n", err)
+		exit(exitFailure)
+	}
+
+	if !askConfirm(fmt.Sprintf("Update hpcgame from %s to %s?", version, strings.TrimPrefix(latest.TagName, "v"))) {
+		fmt.Println("Operation cancelled")
+		return
+	}
+
+	archive, err := downloadWithChecksum(asset.URL, checksum)
+	if err != nil {
+		fmt.Printf("❌ Failed to download %s: %s\n", name, err)
+		exit(exitFailure)
+	}
+	path, err := replaceExecutable(archive)
+	os.Remove(archive)
+	if err != nil {
+		fmt.Printf("❌ Failed to install the update: %s\n", err)
+		exit(exitFailure)
+	}
+	fmt.Printf("✅ hpcgame updated to %s (%s)\n", strings.TrimPrefix(latest.TagName, "v"), path)
+}
+
+// downloadWithChecksum downloads url into a temporary file, keeping the
+// archive extension, and verifies its SHA-256
+func downloadWithChecksum(url string, checksum string) (string, error) {
+	fmt.Printf("Downloading %s\n", url)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	tmpFile, err := os.CreateTemp("", "hpcgame-release-*-"+releaseArchiveName())
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	tmpFile.Close()
+
+	if err := verifySHA256(tmpFile.Name(), checksum); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	fmt.Println("✅ Checksum verified")
+	return tmpFile.Name(), nil
+}
+
+func updateStatePath() (string, error) {
+	hpcgameDir, err := hpcgameHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hpcgameDir, updateStateFile), nil
+}
+
+func saveUpdateState(latest string) {
+	path, err := updateStatePath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(updateState{Checked: time.Now(), Latest: latest})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+		os.WriteFile(path, data, 0600)
+	}
+}
+
+// notifyUpdate prints a notice when a newer release exists. The release feed
+// is queried at most once a day; set update_check to false to disable it.
+func notifyUpdate(command string) {
+	switch command {
+	case "update", completeCommand, "completion", "shell-init", "agent":
+		return
+	}
+	if !releaseBuild() || !loadSettings().Bool("update_check") || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return
+	}
+
+	state := updateState{}
+	path, err := updateStatePath()
+	if err != nil {
+		return
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if time.Since(state.Checked) > updateCheckInterval {
+		latest, err := fetchLatestRelease(2 * time.Second)
+		if err != nil {
+			debugf("Update check failed: %s", err)
+			// Do not retry on every command while offline
+			saveUpdateState(state.Latest)
+			return
+		}
+		state.Latest = latest.TagName
+		saveUpdateState(state.Latest)
+	}
+
+	if state.Latest != "" && newerVersion(state.Latest) {
+		fmt.Fprintf(os.Stderr, "\nA new version of hpcgame is available: %s → %s\n", version, strings.TrimPrefix(state.Latest, "v"))
+		fmt.Fprintln(os.Stderr, "Run 'hpcgame update' to install it, or 'hpcgame config set update_check false' to stop these notices")
+	}
+}
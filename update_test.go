@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// releaseArchive packs binary the way the build workflow does for this platform
+func releaseArchive(t *testing.T, binary []byte) []byte {
+	t.Helper()
+	name := "hpcgame"
+	if runtime.GOOS == "windows" {
+		name = "hpcgame.exe"
+	}
+	var buf bytes.Buffer
+	if runtime.GOOS == "windows" {
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(binary)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "README.md", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hello"))
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg})
+	tw.Write(binary)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// serveRelease starts a release feed at /latest with the archive and a
+// checksums.txt listing checksum for it, and points update_url at it
+func serveRelease(t *testing.T, archive []byte, checksum string) {
+	t.Helper()
+	name := releaseArchiveName()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(release{
+			TagName: "v99.0.0",
+			HTMLURL: server.URL + "/notes",
+			Assets: []releaseAsset{
+				{Name: name, URL: server.URL + "/download/" + name},
+				{Name: checksumsAsset, URL: server.URL + "/download/" + checksumsAsset},
+			},
+		})
+	})
+	mux.HandleFunc("/download/"+name, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/download/"+checksumsAsset, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  hpcgame-other-arch.tar.gz\n", strings.Repeat("0", 64))
+		fmt.Fprintf(w, "%s  %s\n", checksum, name)
+	})
+
+	t.Setenv("HPCGAME_HOME", t.TempDir())
+	t.Setenv("HPCGAME_UPDATE_URL", server.URL+"/latest")
+	cachedSettings = nil
+	t.Cleanup(func() { cachedSettings = nil })
+}
+
+// fetchReleaseArchive goes through the same steps as 'hpcgame update' up to
+// the verified download
+func fetchReleaseArchive(t *testing.T) (string, error) {
+	t.Helper()
+	latest, err := fetchLatestRelease(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.TagName != "v99.0.0" {
+		t.Fatalf("tag = %q, want v99.0.0", latest.TagName)
+	}
+	asset := latest.asset(releaseArchiveName())
+	if asset == nil {
+		t.Fatalf("release has no %s", releaseArchiveName())
+	}
+	checksum, err := releaseChecksum(latest, asset.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return downloadWithChecksum(asset.URL, checksum)
+}
+
+func TestUpdateChecksumMismatch(t *testing.T) {
+	archive := releaseArchive(t, []byte("new binary"))
+	serveRelease(t, archive, strings.Repeat("ab", 32))
+
+	path, err := fetchReleaseArchive(t)
+	if err == nil {
+		os.Remove(path)
+		t.Fatal("download with a wrong checksum succeeded")
+	}
+	if !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestUpdateReplacesBinary(t *testing.T) {
+	archive := releaseArchive(t, []byte("new binary"))
+	sum := sha256.Sum256(archive)
+	serveRelease(t, archive, hex.EncodeToString(sum[:]))
+
+	path, err := fetchReleaseArchive(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	executable := filepath.Join(t.TempDir(), "hpcgame")
+	if err := os.WriteFile(executable, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceBinary(path, executable); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new binary" {
+		t.Fatalf("executable = %q, want the released binary", data)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Fatalf("executable mode = %v, want it executable", info.Mode())
+	}
+	entries, err := os.ReadDir(filepath.Dir(executable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d files left next to the executable, want only the executable", len(entries))
+	}
+}